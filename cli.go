@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	tmversion "github.com/HighStakesSwitzerland/tendermint/version"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Version is set at build time, i.e. go build -ldflags "-X main.Version=v1.2.0"
+var Version = "dev"
+
+const usage = `Usage: multiseed [--home <dir>] [--config <file>] <command> [flags]
+
+Commands:
+  start            run the seed nodes (default)
+  init             generate the config file and the shared node key
+  validate-config  check the config file
+  show-node-id     print the node id and the seed address of every chain
+  export           print the peers of the address books
+  key rotate       generate a new node key
+  version          print the version
+
+The home directory defaults to $HOME/.multiseed and the config file to <home>/config.toml.
+They can also be set with the MULTISEED_HOME and MULTISEED_CONFIG environment variables, and the
+config keys with MULTISEED_<SECTION>_<KEY>, i.e. MULTISEED_HTTP_PORT or MULTISEED_ADMIN_TOKEN.
+Run "multiseed <command> --help" for the flags of a command.
+`
+
+var (
+	homeFlag   = os.Getenv(config.EnvPrefix + "_HOME")
+	configFlag = os.Getenv(config.EnvPrefix + "_CONFIG")
+)
+
+// runCommand parses the global flags and runs the command, start if none is given
+func runCommand(args []string) error {
+	flags := flag.NewFlagSet("multiseed", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	addHomeFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+
+	command := "start"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "start":
+		return runStart(args)
+	case "init":
+		return runInit(args)
+	case "validate-config":
+		return runValidateConfig(args)
+	case "show-node-id":
+		return runShowNodeId(args)
+	case "export":
+		return runExport(args)
+	case "key":
+		return runKeyCommand(args)
+	case "version":
+		return runVersion(args)
+	case "help":
+		fmt.Print(usage)
+		return nil
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %s", command)
+	}
+}
+
+func addHomeFlags(flags *flag.FlagSet) {
+	flags.StringVar(&homeFlag, "home", homeFlag, "multiseed home directory (default $HOME/.multiseed)")
+	flags.StringVar(&configFlag, "config", configFlag, "config file (default <home>/config.toml)")
+}
+
+// newFlagSet returns the flags of a command, including --home and --config
+func newFlagSet(name string, description string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: multiseed %s [flags]\n\n%s\n\nFlags:\n", name, description)
+		flags.PrintDefaults()
+	}
+	addHomeFlags(flags)
+	return flags
+}
+
+// parseFlags parses the flags of a command and applies --home and --config
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %s", flags.Arg(0))
+	}
+	if homeFlag != "" {
+		config.SetHome(homeFlag)
+	}
+	if configFlag != "" {
+		config.SetConfigFile(configFlag)
+	}
+	return nil
+}
+
+func runInit(args []string) error {
+	flags := newFlagSet("init", "Generate the config file and the shared node key")
+	force := flags.Bool("force", false, "overwrite an existing config file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	nodeKey, err := config.InitHome(*force)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generated %s\nShared node key: %s\n\n", config.ConfigFilePath(), nodeKey.ID)
+	fmt.Println("Fill the chain_id and bootstrap-peers of every chain, then run \"multiseed start\".")
+	return nil
+}
+
+func runValidateConfig(args []string) error {
+	flags := newFlagSet("validate-config", "Check the config file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	seedConfigs, err := config.LoadConfigs()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid, %d chains configured\n", config.ConfigFilePath(), len(seedConfigs.ChainConfigs))
+	return nil
+}
+
+func runShowNodeId(args []string) error {
+	flags := newFlagSet("show-node-id", "Print the node id and the seed address of every chain")
+	chainId := flags.String("chain", "", "only print the node id of this chain")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	seedConfigs, err := config.LoadConfigs()
+	if err != nil {
+		return err
+	}
+	sharedKey, err := config.ReadSharedNodeKey()
+	if err != nil {
+		return err
+	}
+
+	if *chainId != "" {
+		cfg := findChain(seedConfigs, *chainId)
+		if cfg == nil {
+			return fmt.Errorf("chain %s is not configured", *chainId)
+		}
+		nodeKey, err := cfg.ReadNodeKey(&sharedKey)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("the node key of chain %s is not generated yet, start the chain to generate it", *chainId)
+		} else if err != nil {
+			return err
+		}
+		fmt.Println(nodeKey.ID)
+		return nil
+	}
+	fmt.Printf("Shared node key: %s\n\n", sharedKey.ID)
+	return printSeedAddresses(seedConfigs, &sharedKey)
+}
+
+// exportedChain is a chain and the peers of its address book, as printed by the export command
+type exportedChain struct {
+	ChainId    string                  `json:"chain_id"`
+	PrettyName string                  `json:"pretty_name"`
+	Peers      []seednode.ExportedPeer `json:"peers"`
+}
+
+func runExport(args []string) error {
+	flags := newFlagSet("export", "Print the peers of the saved address books")
+	chainId := flags.String("chain", "", "only export the peers of this chain")
+	format := flags.String("format", "text", "output format: text (one nodeid@ip:port per line), peers (comma separated, "+
+		"for persistent_peers or seeds), json or addrbook (addrbook.json of a tendermint node, requires --chain)")
+	best := flags.Int("best", 0, "only export the N best peers of every chain: recently connected, reachable, "+
+		"and spread over ASNs and countries")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "peers", "json":
+	case "addrbook":
+		if *chainId == "" {
+			return errors.New("the addrbook format requires --chain")
+		}
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	seedConfigs, err := config.LoadConfigs()
+	if err != nil {
+		return err
+	}
+
+	chains := make([]exportedChain, 0)
+	var addrBook []*pex.KnownAddress
+	for _, cfg := range seedConfigs.ChainConfigs {
+		if *chainId != "" && cfg.ChainId != *chainId {
+			continue
+		}
+		addresses, err := seednode.ReadAddrBookFile(cfg.ChainId)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to read the address book of chain %s: %w", cfg.ChainId, err)
+		}
+		if *best > 0 {
+			probes, err := seednode.ReadProbes(cfg.ChainId)
+			if err != nil {
+				return fmt.Errorf("failed to read the probes of chain %s: %w", cfg.ChainId, err)
+			}
+			addresses = seednode.BestPeers(addresses, probes, *best)
+		}
+		addrBook = addresses
+		chains = append(chains, exportedChain{cfg.ChainId, cfg.PrettyName, seednode.ExportPeers(addresses)})
+	}
+	if *chainId != "" && len(chains) == 0 {
+		return fmt.Errorf("chain %s is not configured", *chainId)
+	}
+
+	switch *format {
+	case "json":
+		return printJson(chains)
+	case "addrbook":
+		return printJson(seednode.NewTendermintAddrBook(addrBook))
+	}
+	for _, chain := range chains {
+		if *chainId == "" {
+			fmt.Printf("# %s [%s]\n", chain.PrettyName, chain.ChainId)
+		}
+		addresses := make([]string, 0, len(chain.Peers))
+		for _, peer := range chain.Peers {
+			addresses = append(addresses, peer.Address)
+		}
+		if *format == "peers" {
+			fmt.Println(strings.Join(addresses, ","))
+		} else if len(addresses) > 0 {
+			fmt.Println(strings.Join(addresses, "\n"))
+		}
+	}
+	return nil
+}
+
+func printJson(v interface{}) error {
+	marshal, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(marshal))
+	return nil
+}
+
+func runVersion(args []string) error {
+	flags := newFlagSet("version", "Print the version")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	fmt.Printf("multiseed %s (tendermint %s, p2p protocol %d, %s)\n", Version, tmversion.TMVersion, tmversion.P2PProtocol, runtime.Version())
+	return nil
+}
+
+// printSeedAddresses prints the nodeid@host:port string of every chain. The node keys are only read, the chains never
+// started don't have one yet
+func printSeedAddresses(seedConfigs *config.TSConfig, sharedKey *types.NodeKey) error {
+	fmt.Println("Seed addresses:")
+	for i := range seedConfigs.ChainConfigs {
+		cfg := &seedConfigs.ChainConfigs[i]
+		nodeKey, err := cfg.ReadNodeKey(sharedKey)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("%s [%s]: node key not generated yet\n", cfg.PrettyName, cfg.ChainId)
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("%s [%s]: %s\n", cfg.PrettyName, cfg.ChainId, cfg.SeedAddress(nodeKey.ID))
+	}
+	return nil
+}
+
+func findChain(seedConfigs *config.TSConfig, chainId string) *config.P2PConfig {
+	for i := range seedConfigs.ChainConfigs {
+		if seedConfigs.ChainConfigs[i].ChainId == chainId {
+			return &seedConfigs.ChainConfigs[i]
+		}
+	}
+	return nil
+}
+
+// exitCodeError makes the process exit with a specific status code, the error is already logged
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func exitOnError(err error) {
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	var code exitCodeError
+	if errors.As(err, &code) {
+		os.Exit(int(code))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: "+err.Error())
+		os.Exit(1)
+	}
+}
@@ -4,7 +4,13 @@ module github.com/highstakesswitzerland/multiseed
 
 require (
 	github.com/HighStakesSwitzerland/tendermint v0.35.16-hss
+	github.com/fsnotify/fsnotify v1.5.4
+	github.com/go-kit/kit v0.12.0
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/oschwald/maxminddb-golang v1.8.0
+	github.com/prometheus/client_golang v1.12.2
+	github.com/spf13/viper v1.12.0
+	go.etcd.io/bbolt v1.3.6
 )
 
 require (
@@ -37,7 +43,6 @@ require (
 	github.com/pelletier/go-toml/v2 v2.0.2 // indirect
 	github.com/petermattis/goid v0.0.0-20180202154549-b0b1615b78e5 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/prometheus/client_golang v1.12.2 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/procfs v0.7.3 // indirect
 	github.com/rs/zerolog v1.27.0 // indirect
@@ -49,7 +54,6 @@ require (
 	github.com/syndtr/goleveldb v1.0.1-0.20200815110645-5c35d600f0ca // indirect
 	github.com/tecbot/gorocksdb v0.0.0-20191217155057-f0fad39f321c // indirect
 	github.com/tendermint/tm-db v0.6.6 // indirect
-	go.etcd.io/bbolt v1.3.6 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/genproto v0.0.0-20220519153652-3a47de7e79bd // indirect
 	google.golang.org/grpc v1.47.0 // indirect
@@ -61,12 +65,9 @@ require (
 
 require (
 	github.com/btcsuite/btcd v0.22.1 // indirect
-	github.com/fsnotify/fsnotify v1.5.4 // indirect
-	github.com/go-kit/kit v0.12.0
 	github.com/pelletier/go-toml v1.9.5 // indirect
 	github.com/prometheus/common v0.32.1 // indirect
 	github.com/sasha-s/go-deadlock v0.3.1 // indirect
-	github.com/spf13/viper v1.12.0
 	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e // indirect
 	golang.org/x/net v0.0.0-20220617184016-355a448f1bc9 // indirect
 	golang.org/x/sys v0.0.0-20220702020025-31831981b65f // indirect
@@ -2,35 +2,100 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/HighStakesSwitzerland/tendermint/config"
 	"github.com/HighStakesSwitzerland/tendermint/libs/log"
 	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/fsnotify/fsnotify"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"reflect"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
+	"time"
 )
 
 var (
-	logger = log.MustNewDefaultLogger("text", "info", false)
+	logger     = log.MustNewDefaultLogger("text", "info", false)
+	homeDir    string
+	configFile string
 )
 
+// SetLogger replaces the logger of the config watcher
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
 // TSConfig extends tendermint P2PConfig with the things we need
 type TSConfig struct {
-	ChainConfigs []P2PConfig `mapstructure:"chains"`
+	ChainConfigs []P2PConfig   `mapstructure:"chains"`
+	Geoloc       GeolocConfig  `mapstructure:"geoloc"`
+	History      HistoryConfig `mapstructure:"history"`
+	Admin        AdminConfig   `mapstructure:"admin"`
+	Health       HealthConfig  `mapstructure:"health"`
+	Crawler      CrawlerConfig `mapstructure:"crawler"`
+	Prober       ProberConfig  `mapstructure:"prober"`
+
+	LogLevel  string `mapstructure:"log_level"`  // i.e. "info,geoloc=debug,p2p=error"
+	LogFormat string `mapstructure:"log_format"` // text or json
+	HttpPort  string `mapstructure:"http_port"`
+}
+
+// GeolocConfig selects and configures the geolocation backend
+type GeolocConfig struct {
+	Provider    string        `mapstructure:"provider"`
+	MmdbPath    string        `mapstructure:"mmdb_path"`
+	MmdbAsnPath string        `mapstructure:"mmdb_asn_path"`
+	CacheTTL    time.Duration `mapstructure:"cache_ttl"`
+	Interval    time.Duration `mapstructure:"interval"`
+}
+
+// HistoryConfig configures the peers count history
+type HistoryConfig struct {
+	Interval  time.Duration `mapstructure:"interval"`  // delay between two samples of every chain
+	Retention time.Duration `mapstructure:"retention"` // samples older are removed, 0 to keep them forever
+}
+
+// AdminConfig protects the admin API, which is disabled when no token is set
+type AdminConfig struct {
+	Token string `mapstructure:"token"`
+}
+
+// HealthConfig configures the /readyz and /api/chains/<chain_id>/status health checks
+type HealthConfig struct {
+	NoPeersTimeout time.Duration `mapstructure:"no_peers_timeout"` // a chain without peers for longer is unhealthy, 0 to disable
+}
 
-	LogLevel string `mapstructure:"log_level"`
-	HttpPort string `mapstructure:"http_port"`
+// CrawlerConfig configures the active crawler, which dials the known addresses of every chain to ask for their peers
+type CrawlerConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Interval        time.Duration `mapstructure:"interval"`         // delay between two rounds
+	BatchSize       int           `mapstructure:"batch_size"`       // addresses dialed per round and chain
+	Concurrency     int           `mapstructure:"concurrency"`      // simultaneous dials per chain
+	ResponseTimeout time.Duration `mapstructure:"response_timeout"` // delay to answer the address request once connected
+	RecrawlAfter    time.Duration `mapstructure:"recrawl_after"`    // an address is not crawled again before this delay
+}
+
+// ProberConfig configures the reachability prober, which handshakes with the known addresses of every chain
+type ProberConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Interval     time.Duration `mapstructure:"interval"`      // delay between two rounds
+	BatchSize    int           `mapstructure:"batch_size"`    // addresses probed per round and chain
+	Concurrency  int           `mapstructure:"concurrency"`   // simultaneous probes per chain
+	Timeout      time.Duration `mapstructure:"timeout"`       // delay to connect and complete the handshake
+	ReprobeAfter time.Duration `mapstructure:"reprobe_after"` // an address is not probed again before this delay
 }
 
 type P2PConfig struct {
 	config.Config `mapstructure:",squash"`
 	ChainId       string `mapstructure:"chain_id"`
 	PrettyName    string `mapstructure:"pretty_name"`
+	NodeKeyFile   string `mapstructure:"node_key_file"` // dedicated node key of the chain, the shared one is used when unset
 }
 
 var configTemplate *template.Template
@@ -45,81 +110,334 @@ func init() {
 	}
 }
 
-func InitConfigs() (*TSConfig, types.NodeKey) {
-	var tsConfig TSConfig
+// EnvPrefix prefixes the environment variables overriding the config file, i.e. MULTISEED_HTTP_PORT
+const EnvPrefix = "MULTISEED"
+
+// keys which can be overridden by an environment variable
+var envKeys = []string{
+	"http_port", "log_level", "log_format",
+	"geoloc.provider", "geoloc.mmdb_path", "geoloc.mmdb_asn_path", "geoloc.cache_ttl", "geoloc.interval",
+	"history.interval", "history.retention",
+	"admin.token",
+	"health.no_peers_timeout",
+	"crawler.enabled", "crawler.interval", "crawler.batch_size", "crawler.concurrency", "crawler.response_timeout",
+	"crawler.recrawl_after",
+	"prober.enabled", "prober.interval", "prober.batch_size", "prober.concurrency", "prober.timeout", "prober.reprobe_after",
+}
+
+// SetHome overrides the multiseed home directory, $HOME/.multiseed by default
+func SetHome(home string) {
+	homeDir = home
+}
+
+// SetConfigFile overrides the path of the config file, config.toml in the home directory by default
+func SetConfigFile(path string) {
+	configFile = path
+}
+
+// HomeDir returns the directory holding the config, the node keys, the address books and the databases
+func HomeDir() string {
+	if homeDir == "" {
+		userHomeDir, err := homedir.Dir()
+		if err != nil {
+			panic(err)
+		}
+		homeDir = filepath.Join(userHomeDir, ".multiseed")
+	}
+	return homeDir
+}
+
+func ConfigFilePath() string {
+	if configFile == "" {
+		return filepath.Join(HomeDir(), "config.toml")
+	}
+	return configFile
+}
+
+// AddrBookPath returns the path of the address book of a chain
+func AddrBookPath(chainId string) string {
+	return filepath.Join(HomeDir(), "addrbook-"+chainId+".json")
+}
+
+// ProbesPath returns the path of the reachability probes results of a chain
+func ProbesPath(chainId string) string {
+	return filepath.Join(HomeDir(), "probes-"+chainId+".json")
+}
+
+// NodeInfosPath returns the path of the NodeInfo reported by the peers of a chain
+func NodeInfosPath(chainId string) string {
+	return filepath.Join(HomeDir(), "nodeinfo-"+chainId+".json")
+}
 
-	userHomeDir, err := homedir.Dir()
+// InitHome creates the home directory with a default config file and the shared node key.
+// An existing config file is only overwritten when force is set
+func InitHome(force bool) (types.NodeKey, error) {
+	if err := os.MkdirAll(HomeDir(), os.ModePerm); err != nil {
+		return types.NodeKey{}, err
+	}
+	configFilePath := ConfigFilePath()
+	if _, err := os.Stat(configFilePath); err == nil && !force {
+		return types.NodeKey{}, fmt.Errorf("config file %s already exists", configFilePath)
+	}
+	tsConfig := initDefaultConfig()
+	if err := writeConfigFile(configFilePath, &tsConfig); err != nil {
+		return types.NodeKey{}, err
+	}
+	return LoadOrGenSharedNodeKey()
+}
+
+// LoadConfigs reads the config file, overridden by the MULTISEED_* environment variables
+func LoadConfigs() (*TSConfig, error) {
+	configFilePath := ConfigFilePath()
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("config file %s not found, run \"multiseed init\" to generate it", configFilePath)
+	}
+	return ReloadConfig()
+}
+
+// LoadOrGenSharedNodeKey returns the node key shared by the chains which don't have their own, generated if missing
+func LoadOrGenSharedNodeKey() (types.NodeKey, error) {
+	return types.LoadOrGenNodeKey(SharedNodeKeyPath())
+}
+
+// ReadSharedNodeKey returns the shared node key without generating it, for the commands which only read the home.
+// The error wraps os.ErrNotExist when it was never generated
+func ReadSharedNodeKey() (types.NodeKey, error) {
+	path := SharedNodeKeyPath()
+	nodeKey, err := types.LoadNodeKey(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return types.NodeKey{}, fmt.Errorf("shared node key %s not found, run \"multiseed init\" or \"multiseed start\" to generate it: %w", path, err)
+	} else if err != nil {
+		return types.NodeKey{}, fmt.Errorf("failed to read node key %s: %w", path, err)
+	}
+	return nodeKey, nil
+}
+
+// SharedNodeKeyPath returns the path of the node key used by the chains without node_key_file
+func SharedNodeKeyPath() string {
+	return filepath.Join(HomeDir(), "node_key.json")
+}
+
+// NodeKeyPath returns the path of the node key of a chain, the shared one when node_key_file is unset.
+// A relative node_key_file is relative to the multiseed home directory
+func (cfg *P2PConfig) NodeKeyPath() string {
+	if cfg.NodeKeyFile == "" {
+		return SharedNodeKeyPath()
+	}
+	if filepath.IsAbs(cfg.NodeKeyFile) {
+		return cfg.NodeKeyFile
+	}
+	return filepath.Join(HomeDir(), cfg.NodeKeyFile)
+}
+
+// UsesSharedNodeKey tells whether a chain uses the shared node key, without node_key_file or pointing to it
+func (cfg *P2PConfig) UsesSharedNodeKey() bool {
+	return filepath.Clean(cfg.NodeKeyPath()) == filepath.Clean(SharedNodeKeyPath())
+}
+
+// LoadNodeKey returns the dedicated node key of a chain, generated if the file doesn't exist yet, or the shared one
+func (cfg *P2PConfig) LoadNodeKey(shared *types.NodeKey) (*types.NodeKey, error) {
+	if cfg.UsesSharedNodeKey() {
+		return shared, nil
+	}
+	path := cfg.NodeKeyPath()
+	nodeKey, err := types.LoadOrGenNodeKey(path)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to load node key %s: %w", path, err)
 	}
+	return &nodeKey, nil
+}
 
-	// init config directory & files if they don't exists yet
-	homeDir := filepath.Join(userHomeDir, ".multiseed")
-	if err = os.MkdirAll(homeDir, os.ModePerm); err != nil {
-		panic(err)
+// ReadNodeKey returns the node key of a chain like LoadNodeKey, without generating it. shared is nil when the shared
+// node key doesn't exist. The error wraps os.ErrNotExist when the key of the chain was never generated
+func (cfg *P2PConfig) ReadNodeKey(shared *types.NodeKey) (*types.NodeKey, error) {
+	if cfg.UsesSharedNodeKey() {
+		if shared == nil {
+			return nil, fmt.Errorf("shared node key %s not found: %w", SharedNodeKeyPath(), os.ErrNotExist)
+		}
+		return shared, nil
 	}
+	path := cfg.NodeKeyPath()
+	nodeKey, err := types.LoadNodeKey(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node key %s: %w", path, err)
+	}
+	return &nodeKey, nil
+}
 
-	configFilePath := filepath.Join(homeDir, "config.toml")
-	viper.SetConfigName("config")
-	viper.AddConfigPath(homeDir)
+// SeedAddress returns the nodeid@host:port string of the seed node of a chain, using the external address if set
+func (cfg *P2PConfig) SeedAddress(nodeId types.NodeID) string {
+	address := cfg.P2P.ExternalAddress
+	if address == "" {
+		address = cfg.P2P.ListenAddress
+	}
+	return nodeId.AddressString(address)
+}
 
-	if err := viper.ReadInConfig(); err == nil {
-		logger.Info(fmt.Sprintf("Loading config file: %s", viper.ConfigFileUsed()))
-		err := viper.Unmarshal(&tsConfig)
-		if err != nil {
-			panic("Invalid config file!")
+/*
+RotateNodeKey replaces the node key stored in path by a new one. The old key is archived next to it,
+suffixed by the rotation time, and its path is returned
+*/
+func RotateNodeKey(path string) (types.NodeKey, string, error) {
+	archivePath := ""
+	if _, err := os.Stat(path); err == nil {
+		archivePath = fmt.Sprintf("%s.%s.bak", path, time.Now().UTC().Format("20060102T150405Z"))
+		if err := os.Rename(path, archivePath); err != nil {
+			return types.NodeKey{}, "", fmt.Errorf("failed to archive node key %s: %w", path, err)
 		}
-	} else if _, ok := err.(viper.ConfigFileNotFoundError); ok { // ignore not found error, return other errors
-		logger.Info("No existing configuration found, generating one")
-		tsConfig = initDefaultConfig()
-		writeConfigFile(configFilePath, &tsConfig)
-		os.Exit(0)
-	} else {
-		panic(err)
+	} else if !os.IsNotExist(err) {
+		return types.NodeKey{}, "", err
 	}
 
-	// only one node key for all chains
-	nodeKeyFilePath := filepath.Join(homeDir, "node_key.json")
-	nodeKey, err := types.LoadOrGenNodeKey(nodeKeyFilePath)
-	if err != nil {
-		panic(err)
+	nodeKey := types.GenNodeKey()
+	if err := nodeKey.SaveAs(path); err != nil {
+		return types.NodeKey{}, archivePath, fmt.Errorf("failed to save node key %s: %w", path, err)
+	}
+	return nodeKey, archivePath, nil
+}
+
+var viperMtx sync.Mutex // serializes the reads of the config file
+
+// newViper returns a viper instance reading the config file, overridden by the MULTISEED_* environment variables
+func newViper() *viper.Viper {
+	v := viper.New()
+	v.SetConfigFile(ConfigFilePath())
+	v.SetConfigType("toml")
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range envKeys {
+		_ = v.BindEnv(key)
+	}
+	return v
+}
+
+/*
+ReloadConfig reads the config file again, to apply its changes at runtime. The file is read into a new viper instance
+every time, and only the configuration decoded from it is returned, so a reload never modifies the configuration
+another goroutine is reading
+*/
+func ReloadConfig() (*TSConfig, error) {
+	viperMtx.Lock()
+	defer viperMtx.Unlock()
+
+	v := newViper()
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var tsConfig TSConfig
+	if err := v.Unmarshal(&tsConfig); err != nil {
+		return nil, err
 	}
+	if err := tsConfig.Validate(v.ConfigFileUsed()); err != nil {
+		return nil, err
+	}
+	return &tsConfig, nil
+}
 
-	logger.Info("Node key for all chains: ", "nodeId", nodeKey.ID)
+// WatchConfig calls onChange with the new configuration when the config file is modified or on SIGHUP.
+// An invalid config file is ignored, the running configuration is kept
+func WatchConfig(onChange func(*TSConfig)) {
+	var mtx sync.Mutex // onChange is never called concurrently
+	reload := func() {
+		mtx.Lock()
+		defer mtx.Unlock()
+		tsConfig, err := ReloadConfig()
+		if err != nil {
+			logger.Error("Invalid config file, changes are ignored: " + err.Error())
+			return
+		}
+		logger.Info(fmt.Sprintf("Reloaded config file: %s", ConfigFilePath()))
+		onChange(tsConfig)
+	}
 
-	checkActiveChains(&tsConfig)
+	if err := watchConfigFile(ConfigFilePath(), reload); err != nil {
+		logger.Error("Failed to watch the config file, send SIGHUP to reload it: " + err.Error())
+	}
 
-	return &tsConfig, nodeKey
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			reload()
+		}
+	}()
 }
 
-func checkActiveChains(tsConfig *TSConfig) {
-	// get field names of the config
-	fieldNames := reflect.TypeOf(TSConfig{})
-	names := make([]string, fieldNames.NumField())
-	for i := range names {
-		names[i] = fieldNames.Field(i).Name
+/*
+watchConfigFile calls reload when the config file is written or replaced. Its directory is watched, as editors and
+kubernetes config maps replace the file, or the target of its symlink, instead of writing it
+*/
+func watchConfigFile(configFilePath string, reload func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	configFilePath = filepath.Clean(configFilePath)
+	if err := watcher.Add(filepath.Dir(configFilePath)); err != nil {
+		watcher.Close()
+		return err
 	}
+	realConfigFile, _ := filepath.EvalSymlinks(configFilePath)
 
-	// for each chain, check the config is ok
-	value := reflect.Indirect(reflect.ValueOf(tsConfig))
-	for i := 0; i < len(names); i++ {
-		chain := value.FieldByName(names[i]).Interface()
-		if reflect.TypeOf(chain) == reflect.TypeOf(P2PConfig{}) {
-			chainCfg := chain.(P2PConfig)
-			if chainCfg.ChainId == "" || chainCfg.P2P.BootstrapPeers == "" {
-				logger.Info(fmt.Sprintf("%s config is incomplete, this chain will not be used", names[i]))
-			} else {
-				value.FieldByName(names[i]).FieldByName("Enable").SetBool(true)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				currentConfigFile, _ := filepath.EvalSymlinks(configFilePath)
+				written := filepath.Clean(event.Name) == configFilePath && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if written || currentConfigFile != "" && currentConfigFile != realConfigFile {
+					realConfigFile = currentConfigFile
+					reload()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Error("Config file watcher error: " + err.Error())
 			}
 		}
-	}
+	}()
+	return nil
 }
 
 func initDefaultConfig() TSConfig {
 	tsConfig := TSConfig{
 		ChainConfigs: []P2PConfig{*defaultP2PConfig(0)},
-		LogLevel:     "info",
-		HttpPort:     "8090",
+		Geoloc: GeolocConfig{
+			Provider: "ip-api",
+			CacheTTL: 30 * 24 * time.Hour,
+			Interval: 60 * time.Second,
+		},
+		History: HistoryConfig{
+			Interval:  5 * time.Minute,
+			Retention: 365 * 24 * time.Hour,
+		},
+		Health: HealthConfig{
+			NoPeersTimeout: 15 * time.Minute,
+		},
+		Crawler: CrawlerConfig{
+			Enabled:         true,
+			Interval:        60 * time.Second,
+			BatchSize:       30,
+			Concurrency:     10,
+			ResponseTimeout: 30 * time.Second,
+			RecrawlAfter:    time.Hour,
+		},
+		Prober: ProberConfig{
+			Enabled:      true,
+			Interval:     60 * time.Second,
+			BatchSize:    50,
+			Concurrency:  10,
+			Timeout:      10 * time.Second,
+			ReprobeAfter: 6 * time.Hour,
+		},
+		LogLevel:  "info",
+		LogFormat: "text",
+		HttpPort:  "8090",
 	}
 	return tsConfig
 }
@@ -132,13 +450,13 @@ func defaultP2PConfig(port int) *P2PConfig {
 	return p
 }
 
-// WriteConfigFile renders config using the template and writes it to configFilePath.
-func writeConfigFile(configFilePath string, config *TSConfig) {
+// writeConfigFile renders config using the template and writes it to configFilePath.
+func writeConfigFile(configFilePath string, config *TSConfig) error {
 	var buffer bytes.Buffer
 
 	if err := configTemplate.Execute(&buffer, config); err != nil {
-		panic(err)
+		return err
 	}
 
-	_ = os.WriteFile(configFilePath, buffer.Bytes(), 0644)
+	return os.WriteFile(configFilePath, buffer.Bytes(), 0644)
 }
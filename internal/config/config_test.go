@@ -0,0 +1,115 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNodeKeyPath(t *testing.T) {
+	home := t.TempDir()
+	SetHome(home)
+
+	tests := []struct {
+		name        string
+		nodeKeyFile string
+		want        string
+		shared      bool
+	}{
+		{"shared by default", "", filepath.Join(home, "node_key.json"), true},
+		{"dedicated", "node_key-cosmoshub-4.json", filepath.Join(home, "node_key-cosmoshub-4.json"), false},
+		{"relative", "keys/cosmoshub.json", filepath.Join(home, "keys/cosmoshub.json"), false},
+		{"absolute", "/etc/multiseed/cosmoshub.json", "/etc/multiseed/cosmoshub.json", false},
+		{"shared", "node_key.json", filepath.Join(home, "node_key.json"), true},
+		{"shared absolute", filepath.Join(home, "node_key.json"), filepath.Join(home, "node_key.json"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := P2PConfig{ChainId: "cosmoshub-4", NodeKeyFile: tt.nodeKeyFile}
+			if got := cfg.NodeKeyPath(); got != tt.want {
+				t.Errorf("NodeKeyPath() = %s, want %s", got, tt.want)
+			}
+			if shared := cfg.UsesSharedNodeKey(); shared != tt.shared {
+				t.Errorf("UsesSharedNodeKey() = %v, want %v", shared, tt.shared)
+			}
+		})
+	}
+}
+
+func TestReadNodeKeyDoesNotGenerate(t *testing.T) {
+	SetHome(t.TempDir())
+	cfg := P2PConfig{ChainId: "cosmoshub-4", NodeKeyFile: "node_key-cosmoshub-4.json"}
+
+	if _, err := cfg.ReadNodeKey(nil); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadNodeKey() error = %v, want os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(cfg.NodeKeyPath()); !os.IsNotExist(err) {
+		t.Fatal("ReadNodeKey() generated the node key")
+	}
+	generated, err := cfg.LoadNodeKey(nil)
+	if err != nil {
+		t.Fatalf("LoadNodeKey() error = %v", err)
+	}
+	read, err := cfg.ReadNodeKey(nil)
+	if err != nil || read.ID != generated.ID {
+		t.Errorf("ReadNodeKey() = %v, %v, want the generated key %s", read, err, generated.ID)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(path string) error
+	}{
+		{"written", func(path string) error {
+			return os.WriteFile(path, []byte("http_port = \"8091\"\n"), 0644)
+		}},
+		{"replaced", func(path string) error {
+			if err := os.WriteFile(path+".new", []byte("http_port = \"8091\"\n"), 0644); err != nil {
+				return err
+			}
+			return os.Rename(path+".new", path)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte("http_port = \"8090\"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			reloaded := make(chan struct{}, 10)
+			if err := watchConfigFile(path, func() { reloaded <- struct{}{} }); err != nil {
+				t.Fatalf("watchConfigFile() error = %v", err)
+			}
+			if err := tt.change(path); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-reloaded:
+			case <-time.After(5 * time.Second):
+				t.Error("the config file was not reloaded")
+			}
+		})
+	}
+}
+
+func TestReadSharedNodeKeyDoesNotGenerate(t *testing.T) {
+	SetHome(t.TempDir())
+
+	if _, err := ReadSharedNodeKey(); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("ReadSharedNodeKey() error = %v, want os.ErrNotExist", err)
+	}
+	if _, err := os.Stat(SharedNodeKeyPath()); !os.IsNotExist(err) {
+		t.Fatal("ReadSharedNodeKey() generated the shared node key")
+	}
+	generated, err := LoadOrGenSharedNodeKey()
+	if err != nil {
+		t.Fatalf("LoadOrGenSharedNodeKey() error = %v", err)
+	}
+	read, err := ReadSharedNodeKey()
+	if err != nil || read.ID != generated.ID {
+		t.Errorf("ReadSharedNodeKey() = %v, %v, want the generated key %s", read.ID, err, generated.ID)
+	}
+}
@@ -13,16 +13,88 @@ const defaultConfigTemplate = `# This is a TOML config file.
 #######################################################
 # Port for the frontend
 http_port = "{{ .HttpPort }}"
+# Log level: debug, info, warn, error or none, optionally followed by the level of some modules,
+# i.e. "info,geoloc=debug,p2p=error". The modules are main, config, seednode, geoloc, history, http and p2p.
+# p2p logs the tendermint switch and pex reactor of every chain and is disabled by default,
+# p2p.<chain_id> sets the level of a single chain, i.e. "info,p2p.cosmoshub-4=debug"
+log_level = "{{ .LogLevel }}"
+# Log format: text or json
+log_format = "{{ .LogFormat }}"
+
+# Geolocation of the peers
+[geoloc]
+# Backend used to resolve the peers location. Available: "ip-api", "mmdb"
+provider = "{{ .Geoloc.Provider }}"
+# Path of a MaxMind GeoLite2-City or DB-IP City Lite .mmdb file, used by the "mmdb" provider.
+# The file is reloaded when it changes on disk
+mmdb_path = "{{ .Geoloc.MmdbPath }}"
+# Optional GeoLite2-ASN or DB-IP ASN Lite .mmdb file, to resolve the ASN and organization
+mmdb_asn_path = "{{ .Geoloc.MmdbAsnPath }}"
+# Resolved IPs are cached in the home directory and shared by all the chains. Entries expire after this duration
+cache_ttl = "{{ .Geoloc.CacheTTL }}"
+# Delay between two geolocation rounds. The quota of the provider is shared between all the chains on each round,
+# and the requests are paced according to the remaining quota reported by the service
+interval = "{{ .Geoloc.Interval }}"
+
+# Peers count history of every chain
+[history]
+# Delay between two samples of every chain
+interval = "{{ .History.Interval }}"
+# Samples older than this duration are removed, 0 to keep them forever
+retention = "{{ .History.Retention }}"
+
+# Admin API on /api/admin, to manage the chains at runtime. Requests must set the "Authorization: Bearer <token>" header.
+# The admin API is disabled when the token is empty
+[admin]
+token = "{{ .Admin.Token }}"
+
+# Health checks on /readyz and /api/chains/<chain_id>/status, which return 503 when a chain is unhealthy
+[health]
+# A running chain which has had no peer for longer than this duration is unhealthy, 0 to disable this check
+no_peers_timeout = "{{ .Health.NoPeersTimeout }}"
+
+# Active crawler: every interval, dials the known addresses of every chain which were not crawled recently,
+# asks them for their peers and disconnects, so the address book covers the whole reachable network
+[crawler]
+enabled = {{ .Crawler.Enabled }}
+# Delay between two rounds
+interval = "{{ .Crawler.Interval }}"
+# Number of addresses dialed per round and chain, and how many at the same time
+batch_size = {{ .Crawler.BatchSize }}
+concurrency = {{ .Crawler.Concurrency }}
+# Delay for a connected peer to send its addresses before it is disconnected
+response_timeout = "{{ .Crawler.ResponseTimeout }}"
+# An address is not crawled again before this delay
+recrawl_after = "{{ .Crawler.RecrawlAfter }}"
+
+# Reachability prober: every interval, connects to the known addresses of every chain which were not probed since
+# reprobe_after and completes a tendermint handshake, to tell the public nodes from the ones behind a NAT or firewall
+[prober]
+enabled = {{ .Prober.Enabled }}
+# Delay between two rounds
+interval = "{{ .Prober.Interval }}"
+# Number of addresses probed per round and chain, and how many at the same time
+batch_size = {{ .Prober.BatchSize }}
+concurrency = {{ .Prober.Concurrency }}
+# Delay to connect and complete the handshake
+timeout = "{{ .Prober.Timeout }}"
+# An address is not probed again before this delay
+reprobe_after = "{{ .Prober.ReprobeAfter }}"
 
 # Chains specific config
 [[chains]]
 pretty_name = "Cosmos Hub"
 chain_id = "cosmoshub-4"
-p2p.bootstrap-peers = "ade4d8bc8cbe014af6ebdf3cb7b1e9ad36f412c0@seeds.polkachu.com:14956,6e08b23315a9f0e1b23c7ed847934f7d6f848c8b@165.232.156.86:26656,ee27245d88c632a556cf72cc7f35873\
-80c09b469@45.79.249.253:26656,538ebe0086f0f5e9ca922dae0462cc87e22f0a50@34.122.34.67:26656,d3209b9f88eec64f10555a11ecbf797bb0fa29f4@34.125.169.233:26656,bdc2c3d410ca7731411b7e46a25201\
-2323fbbf37@34.83.209.166:26656,585794737e6b318957088e645e17c0669f3b11fc@54.160.123.34:26656,5b4ed476e01c49b23851258d867cc0cfc0c10e58@206.189.4.227:26656"
+p2p.bootstrap-peers = "ade4d8bc8cbe014af6ebdf3cb7b1e9ad36f412c0@seeds.polkachu.com:14956,6e08b23315a9f0e1b23c7ed847934f7d6f848c8b@165.232.156.86:26656,ee27245d88c632a556cf72cc7f3587380c09b469@45.79.249.253:26656,538ebe0086f0f5e9ca922dae0462cc87e22f0a50@34.122.34.67:26656,d3209b9f88eec64f10555a11ecbf797bb0fa29f4@34.125.169.233:26656,bdc2c3d410ca7731411b7e46a252012323fbbf37@34.83.209.166:26656,585794737e6b318957088e645e17c0669f3b11fc@54.160.123.34:26656,5b4ed476e01c49b23851258d867cc0cfc0c10e58@206.189.4.227:26656"
 p2p.laddr = "tcp://0.0.0.0:26656"
+# Dedicated node key of this chain, i.e. "node_key-cosmoshub-4.json", generated if it doesn't exist.
+# The node key shared by all the chains is used when empty
+node_key_file = ""
 
-[[chains]]
-...
+# Add a [[chains]] block for every other chain, with its own p2p.laddr
+# [[chains]]
+# pretty_name = "Osmosis"
+# chain_id = "osmosis-1"
+# p2p.bootstrap-peers = "nodeid@host:port,..."
+# p2p.laddr = "tcp://0.0.0.0:26657"
 `
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	tmstrings "github.com/HighStakesSwitzerland/tendermint/libs/strings"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/logging"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ValidationError lists every problem found in the config file
+type ValidationError struct {
+	Path   string
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d errors in %s:\n  %s", len(e.Errors), e.Path, strings.Join(e.Errors, "\n  "))
+}
+
+/*
+Validate checks the whole configuration and reports all the problems at once, before any chain is started.
+configFilePath is only used to point the errors to the line of the config file, it can be empty
+*/
+func (c *TSConfig) Validate(configFilePath string) error {
+	lines := scanChainLines(configFilePath)
+	var errs []string
+	addError := func(line int, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if line > 0 {
+			msg = fmt.Sprintf("line %d: %s", line, msg)
+		}
+		errs = append(errs, msg)
+	}
+
+	if _, err := logging.ParseLevels(c.LogLevel); err != nil {
+		addError(lines.global["log_level"], "invalid log_level: %s", err.Error())
+	}
+	if err := logging.CheckFormat(c.LogFormat); err != nil {
+		addError(lines.global["log_format"], "invalid log_format: %s", err.Error())
+	}
+
+	httpPort, err := parsePort(c.HttpPort)
+	if err != nil {
+		addError(lines.global["http_port"], "invalid http_port %q: %s", c.HttpPort, err.Error())
+	}
+
+	if c.Health.NoPeersTimeout < 0 {
+		addError(lines.global["health.no_peers_timeout"], "invalid health.no_peers_timeout: must not be negative")
+	}
+	// zero values of the history interval, the crawler and the prober fall back to their defaults
+	positiveValues := []struct {
+		key      string
+		negative bool
+	}{
+		{"history.interval", c.History.Interval < 0},
+		{"history.retention", c.History.Retention < 0},
+		{"crawler.interval", c.Crawler.Interval < 0},
+		{"crawler.batch_size", c.Crawler.BatchSize < 0},
+		{"crawler.concurrency", c.Crawler.Concurrency < 0},
+		{"crawler.response_timeout", c.Crawler.ResponseTimeout < 0},
+		{"crawler.recrawl_after", c.Crawler.RecrawlAfter < 0},
+		{"prober.interval", c.Prober.Interval < 0},
+		{"prober.batch_size", c.Prober.BatchSize < 0},
+		{"prober.concurrency", c.Prober.Concurrency < 0},
+		{"prober.timeout", c.Prober.Timeout < 0},
+		{"prober.reprobe_after", c.Prober.ReprobeAfter < 0},
+	}
+	for _, value := range positiveValues {
+		if value.negative {
+			addError(lines.global[value.key], "invalid %s: must not be negative", value.key)
+		}
+	}
+
+	if len(c.ChainConfigs) == 0 {
+		addError(0, "no [[chains]] configured")
+	}
+	chainIds := make(map[string]int)
+	ports := make(map[uint16]string)
+	if httpPort > 0 {
+		ports[httpPort] = "http_port"
+	}
+	for i, chain := range c.ChainConfigs {
+		keys := lines.chain(i)
+		name := fmt.Sprintf("chains[%d]", i)
+		if chain.ChainId != "" {
+			name = fmt.Sprintf("chain %s", chain.ChainId)
+		}
+
+		switch {
+		case chain.ChainId == "":
+			addError(keys.line("chain_id"), "%s: chain_id is empty", name)
+		case chainIds[chain.ChainId] > 0:
+			addError(keys.line("chain_id"), "%s: chain_id is already used by chains[%d]", name, chainIds[chain.ChainId]-1)
+		default:
+			chainIds[chain.ChainId] = i + 1
+		}
+
+		if chain.P2P == nil {
+			addError(keys.header, "%s: missing p2p config", name)
+			continue
+		}
+
+		if strings.TrimSpace(chain.P2P.BootstrapPeers) == "" {
+			addError(keys.line("p2p.bootstrap-peers"), "%s: bootstrap-peers is empty", name)
+		} else {
+			for _, peer := range tmstrings.SplitAndTrim(chain.P2P.BootstrapPeers, ",", " ") {
+				if err := validatePeerAddress(peer); err != nil {
+					addError(keys.line("p2p.bootstrap-peers"), "%s: invalid bootstrap peer %q: %s", name, peer, err.Error())
+				}
+			}
+		}
+
+		port, err := parseListenPort(chain.P2P.ListenAddress)
+		if err != nil {
+			addError(keys.line("p2p.laddr"), "%s: invalid laddr %q: %s", name, chain.P2P.ListenAddress, err.Error())
+		} else if other, ok := ports[port]; ok {
+			addError(keys.line("p2p.laddr"), "%s: port %d of laddr is already used by %s", name, port, other)
+		} else {
+			ports[port] = name
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{configFilePath, errs}
+	}
+	return nil
+}
+
+// validatePeerAddress checks a nodeid@host:port address, without resolving the host
+func validatePeerAddress(address string) error {
+	spl := strings.Split(address, "@")
+	if len(spl) != 2 {
+		return fmt.Errorf("expected nodeid@host:port")
+	}
+	id, err := types.NewNodeID(spl[0])
+	if err != nil {
+		return err
+	}
+	if err := id.Validate(); err != nil {
+		return err
+	}
+	host, port, err := net.SplitHostPort(spl[1])
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("host is empty")
+	}
+	_, err = parsePort(port)
+	return err
+}
+
+// parseListenPort returns the port of a listen address such as tcp://0.0.0.0:26656
+func parseListenPort(laddr string) (uint16, error) {
+	hostPort := laddr
+	if i := strings.Index(laddr, "://"); i >= 0 {
+		hostPort = laddr[i+3:]
+	}
+	_, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return 0, err
+	}
+	return parsePort(port)
+}
+
+func parsePort(port string) (uint16, error) {
+	value, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("expected a port number between 1 and 65535")
+	}
+	return uint16(value), nil
+}
+
+// configLines holds the line numbers of the keys of the config file, to give some context to the errors
+type configLines struct {
+	global map[string]int
+	chains []chainLines
+}
+
+type chainLines struct {
+	header int // line of the [[chains]] header
+	keys   map[string]int
+}
+
+func (l configLines) chain(i int) chainLines {
+	if i < len(l.chains) {
+		return l.chains[i]
+	}
+	return chainLines{}
+}
+
+// line returns the line of a key of the chain, or of its [[chains]] header if the key is not set
+func (l chainLines) line(key string) int {
+	if line, ok := l.keys[key]; ok {
+		return line
+	}
+	return l.header
+}
+
+/*
+scanChainLines finds the line of every key of the config file. It doesn't parse TOML, it only follows the
+[[chains]] and [section] headers, which is enough to locate the keys validated above
+*/
+func scanChainLines(configFilePath string) configLines {
+	lines := configLines{global: make(map[string]int)}
+	file, err := os.Open(configFilePath)
+	if err != nil {
+		return lines
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024) // bootstrap peers lines can be long
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case line == "[[chains]]":
+			section = "chains"
+			lines.chains = append(lines.chains, chainLines{header: lineNumber, keys: make(map[string]int)})
+		case strings.HasPrefix(line, "["):
+			section = strings.Trim(line, "[] ")
+		case strings.Contains(line, "="):
+			key := strings.TrimSpace(line[:strings.Index(line, "=")])
+			switch {
+			case section == "":
+				lines.global[key] = lineNumber
+			case section == "chains" && len(lines.chains) > 0:
+				lines.chains[len(lines.chains)-1].keys[key] = lineNumber
+			case section == "chains.p2p" && len(lines.chains) > 0:
+				lines.chains[len(lines.chains)-1].keys["p2p."+key] = lineNumber
+			case !strings.HasPrefix(section, "chains"):
+				lines.global[section+"."+key] = lineNumber
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const validPeer = "ade4d8bc8cbe014af6ebdf3cb7b1e9ad36f412c0@seeds.polkachu.com:14956"
+
+func validConfig() TSConfig {
+	tsConfig := initDefaultConfig()
+	tsConfig.ChainConfigs[0].ChainId = "cosmoshub-4"
+	tsConfig.ChainConfigs[0].P2P.BootstrapPeers = validPeer
+	osmosis := defaultP2PConfig(1)
+	osmosis.ChainId = "osmosis-1"
+	osmosis.P2P.BootstrapPeers = validPeer
+	tsConfig.ChainConfigs = append(tsConfig.ChainConfigs, *osmosis)
+	return tsConfig
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *TSConfig)
+		errors []string // expected errors, in order
+	}{
+		{"valid", func(c *TSConfig) {}, nil},
+		{"invalid log level", func(c *TSConfig) { c.LogLevel = "verbose" }, []string{"invalid log_level"}},
+		{"invalid log format", func(c *TSConfig) { c.LogFormat = "xml" }, []string{"invalid log_format"}},
+		{"invalid http port", func(c *TSConfig) { c.HttpPort = "http" }, []string{"invalid http_port"}},
+		{"negative durations", func(c *TSConfig) {
+			c.History.Interval = -time.Second
+			c.Prober.Timeout = -time.Second
+		}, []string{"invalid history.interval", "invalid prober.timeout"}},
+		{"zero durations fall back to defaults", func(c *TSConfig) {
+			c.History.Interval = 0
+			c.Crawler.Interval = 0
+		}, nil},
+		{"no chains", func(c *TSConfig) { c.ChainConfigs = nil }, []string{"no [[chains]] configured"}},
+		{"empty chain id", func(c *TSConfig) { c.ChainConfigs[1].ChainId = "" }, []string{"chains[1]: chain_id is empty"}},
+		{"duplicated chain id", func(c *TSConfig) { c.ChainConfigs[1].ChainId = "cosmoshub-4" },
+			[]string{"chain cosmoshub-4: chain_id is already used by chains[0]"}},
+		{"missing p2p", func(c *TSConfig) { c.ChainConfigs[1].P2P = nil }, []string{"chain osmosis-1: missing p2p config"}},
+		{"no bootstrap peers", func(c *TSConfig) { c.ChainConfigs[1].P2P.BootstrapPeers = " " },
+			[]string{"chain osmosis-1: bootstrap-peers is empty"}},
+		{"invalid bootstrap peers", func(c *TSConfig) {
+			c.ChainConfigs[1].P2P.BootstrapPeers = validPeer + ",seeds.polkachu.com:14956,nothex@1.2.3.4:26656"
+		}, []string{"invalid bootstrap peer \"seeds.polkachu.com:14956\"", "invalid bootstrap peer \"nothex@1.2.3.4:26656\""}},
+		{"invalid laddr", func(c *TSConfig) { c.ChainConfigs[1].P2P.ListenAddress = "tcp://0.0.0.0" },
+			[]string{"chain osmosis-1: invalid laddr"}},
+		{"clashing laddr", func(c *TSConfig) { c.ChainConfigs[1].P2P.ListenAddress = "tcp://127.0.0.1:26656" },
+			[]string{"chain osmosis-1: port 26656 of laddr is already used by chain cosmoshub-4"}},
+		{"laddr on the http port", func(c *TSConfig) { c.ChainConfigs[1].P2P.ListenAddress = "tcp://0.0.0.0:8090" },
+			[]string{"chain osmosis-1: port 8090 of laddr is already used by http_port"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tsConfig := validConfig()
+			tt.modify(&tsConfig)
+			err := tsConfig.Validate("")
+			if len(tt.errors) == 0 {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate() error = %v, want a ValidationError", err)
+			}
+			if len(validationErr.Errors) != len(tt.errors) {
+				t.Fatalf("Validate() errors = %q, want %d errors", validationErr.Errors, len(tt.errors))
+			}
+			for i, want := range tt.errors {
+				if !strings.Contains(validationErr.Errors[i], want) {
+					t.Errorf("Validate() error %d = %q, want it to contain %q", i, validationErr.Errors[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLines(t *testing.T) {
+	configFilePath := filepath.Join(t.TempDir(), "config.toml")
+	content := `http_port = "8090"
+
+[prober]
+timeout = "-1s"
+
+[[chains]]
+chain_id = "cosmoshub-4"
+
+[[chains]]
+chain_id = "cosmoshub-4"
+[chains.p2p]
+laddr = "tcp://0.0.0.0:26656"
+`
+	if err := os.WriteFile(configFilePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tsConfig := validConfig()
+	tsConfig.Prober.Timeout = -time.Second
+	tsConfig.ChainConfigs[1].ChainId = "cosmoshub-4"
+	tsConfig.ChainConfigs[1].P2P.ListenAddress = "tcp://0.0.0.0:26656"
+
+	err := tsConfig.Validate(configFilePath)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() error = %v, want a ValidationError", err)
+	}
+	want := []string{"line 4: ", "line 10: ", "line 12: "}
+	if len(validationErr.Errors) != len(want) {
+		t.Fatalf("Validate() errors = %q, want %d errors", validationErr.Errors, len(want))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(validationErr.Errors[i], prefix) {
+			t.Errorf("Validate() error %d = %q, want the prefix %q", i, validationErr.Errors[i], prefix)
+		}
+	}
+}
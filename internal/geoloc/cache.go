@@ -0,0 +1,143 @@
+package geoloc
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheTTL = 30 * 24 * time.Hour
+)
+
+var (
+	cache = newGeolocCache("", defaultCacheTTL)
+)
+
+/*
+geolocCache is an IP -> geolocation cache shared by all the chains, so an operator running nodes on several
+chains is resolved only once. It is persisted in the multiseed home directory and entries expire after the TTL.
+*/
+type geolocCache struct {
+	mtx      sync.RWMutex
+	filePath string
+	ttl      time.Duration
+	entries  map[string]cacheEntry // keyed by canonical IP, see ipKey
+	dirty    bool
+}
+
+type cacheEntry struct {
+	Data       GeolocData `json:"data"`
+	ResolvedAt time.Time  `json:"resolved_at"`
+}
+
+func newGeolocCache(filePath string, ttl time.Duration) *geolocCache {
+	return &geolocCache{
+		filePath: filePath,
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+	}
+}
+
+// LoadCache loads the geolocation cache from the multiseed home directory, dropping expired entries
+func LoadCache(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	cache = newGeolocCache(filepath.Join(config.HomeDir(), "geoloc_cache.json"), ttl)
+	if err := cache.load(); err != nil {
+		logger.Error("Could not load the geolocation cache, starting with an empty one: " + err.Error())
+		return
+	}
+	logger.Info(fmt.Sprintf("Loaded %d entries from the geolocation cache", cache.size()))
+}
+
+func (c *geolocCache) get(ip net.IP) (GeolocData, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+
+	entry, ok := c.entries[ipKey(ip)]
+	if !ok || time.Since(entry.ResolvedAt) > c.ttl {
+		return GeolocData{}, false
+	}
+	return entry.Data, true
+}
+
+func (c *geolocCache) has(ip net.IP) bool {
+	_, ok := c.get(ip)
+	return ok
+}
+
+func (c *geolocCache) put(data GeolocData) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries[ipKey(data.IP)] = cacheEntry{
+		Data:       data,
+		ResolvedAt: time.Now(),
+	}
+	c.dirty = true
+}
+
+func (c *geolocCache) size() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return len(c.entries)
+}
+
+func (c *geolocCache) load() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	content, err := os.ReadFile(c.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		return err
+	}
+	c.purgeExpired()
+	return nil
+}
+
+// save writes the cache to disk if it has been modified since the last save
+func (c *geolocCache) save() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.dirty || c.filePath == "" {
+		return
+	}
+	c.purgeExpired()
+	content, err := json.Marshal(c.entries)
+	if err != nil {
+		logger.Error("Failed to marshal the geolocation cache: " + err.Error())
+		return
+	}
+	// write to a temp file first so a crash never leaves a truncated cache
+	tmpFile := c.filePath + ".tmp"
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		logger.Error("Failed to save the geolocation cache: " + err.Error())
+		return
+	}
+	if err := os.Rename(tmpFile, c.filePath); err != nil {
+		logger.Error("Failed to save the geolocation cache: " + err.Error())
+		return
+	}
+	c.dirty = false
+}
+
+func (c *geolocCache) purgeExpired() {
+	for ip, entry := range c.entries {
+		if time.Since(entry.ResolvedAt) > c.ttl {
+			delete(c.entries, ip)
+		}
+	}
+}
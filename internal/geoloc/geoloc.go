@@ -1,29 +1,28 @@
 package geoloc
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
 	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
 	"github.com/HighStakesSwitzerland/tendermint/libs/log"
 	"github.com/HighStakesSwitzerland/tendermint/types"
-	"github.com/go-kit/kit/transport/http/jsonrpc"
 	"github.com/highstakesswitzerland/multiseed/internal/seednode"
-	"io"
-	"io/ioutil"
 	mrand "math/rand"
 	"net"
-	"net/http"
 	"time"
 )
 
 var (
-	ResolvedPeers = make(map[string]Chain)
+	ResolvedPeers = NewPeerStore()
 	logger        = log.MustNewDefaultLogger("text", "info", false)
-	ipApiUrl      = "http://ip-api.com/batch"
 )
 
+// SetLogger sets the logger of the geolocation scheduler and providers
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
 type Chain struct {
 	ChainId    string              `json:"chain_id"`
 	PrettyName string              `json:"pretty_name"`
@@ -31,46 +30,43 @@ type Chain struct {
 }
 
 type GeolocalizedPeers struct {
-	Moniker  string       `json:"moniker"`
-	IP       net.IP       `json:"-"` // IPs should not be sent to the frontend
-	Port     uint16       `json:"-"`
-	NodeId   types.NodeID `json:"node_id"`
-	LastSeen time.Time    `json:"last_seen"`
-	Country  string       `json:"country"`
-	Region   string       `json:"region"`
-	City     string       `json:"city"`
-	Lat      float32      `json:"lat"`
-	Lon      float32      `json:"lon"`
-	Isp      string       `json:"isp"`
-	Org      string       `json:"org"`
-	As       string       `json:"as"`
-}
-
-type ipServiceResponse struct {
-	Status      string  `json:"status"`
-	Country     string  `json:"country"`
-	CountryCode string  `json:"country_code"`
-	Region      string  `json:"region"`
-	RegionName  string  `json:"region_name"`
-	City        string  `json:"city"`
-	Zip         string  `json:"zip"`
-	Lat         float32 `json:"lat"`
-	Lon         float32 `json:"lon"`
-	Timezone    string  `json:"timezone"`
-	Isp         string  `json:"isp"`
-	Org         string  `json:"org"`
-	As          string  `json:"as"`
-	Query       string  `json:"Query"`
+	Moniker             string       `json:"moniker"`
+	IP                  net.IP       `json:"-"` // IPs should not be sent to the frontend
+	Port                uint16       `json:"-"`
+	NodeId              types.NodeID `json:"node_id"`
+	FirstSeen           time.Time    `json:"first_seen"`
+	LastSeen            time.Time    `json:"last_seen"`
+	LastAttempt         time.Time    `json:"last_attempt"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Status              PeerStatus   `json:"status"`
+	Country             string       `json:"country"`
+	Region              string       `json:"region"`
+	City                string       `json:"city"`
+	Lat                 float32      `json:"lat"`
+	Lon                 float32      `json:"lon"`
+	Isp                 string       `json:"isp"`
+	Org                 string       `json:"org"`
+	As                  string       `json:"as"`
+	Reachability        Reachability `json:"reachability"`
+	LastProbe           *time.Time   `json:"last_probe,omitempty"`
+	HandshakeMs         int64        `json:"handshake_ms,omitempty"`
+	Version             string       `json:"version,omitempty"` // software version reported by the node
+	P2PVersion          uint64       `json:"p2p_version,omitempty"`
+	BlockVersion        uint64       `json:"block_version,omitempty"`
+	AppVersion          uint64       `json:"app_version,omitempty"`
+	Network             string       `json:"network,omitempty"`
+	Channels            string       `json:"channels,omitempty"`
+	TxIndex             string       `json:"tx_index,omitempty"`
+	RPCAddress          string       `json:"rpc_address,omitempty"`
 }
 
 /*
-Resolve ips using https://ip-api.com/ geolocation free service
-Appends the new resolved peers to the ResolvedPeers slice, so we keep the full list since the startup
+Resolve the given peers of a chain using the configured geolocation provider
+Upserts the new resolved peers in the ResolvedPeers store, so we keep the full list since the startup
 */
-func ResolveIps(cfg seednode.SeedNodeConfig) {
+func resolveChain(ctx context.Context, cfg seednode.SeedNodeConfig, unresolvedPeers []*seednode.Peer) error {
 	chainId := cfg.Sw.NodeInfo().Network
-	chain := ResolvedPeers[chainId]
-	geolocalizedPeers := resolve(get45UnresolvedPeers(cfg, chainId)) //will limit to 45 peers
+	geolocalizedPeers, err := resolve(ctx, unresolvedPeers)
 	for _, peer := range geolocalizedPeers {
 		// save the peer to the address book if it doesn't exist
 		err := cfg.AddrBook.AddAddress(&p2p.NetAddress{
@@ -82,7 +78,7 @@ func ResolveIps(cfg seednode.SeedNodeConfig) {
 			logger.Error("Error adding peer to address book: " + err.Error())
 		}
 		for _, address := range cfg.AddrBook.GetAddrbookContent() {
-			if address.Addr.IP.String() == peer.IP.String() {
+			if sameIP(address.Addr.IP, peer.IP) {
 				// element exists in address book (hopefully always the case), we need to update it
 				address.Org = peer.Org
 				address.As = peer.As
@@ -96,38 +92,14 @@ func ResolveIps(cfg seednode.SeedNodeConfig) {
 			}
 		}
 	}
-	for _, newPeer := range geolocalizedPeers {
-		found := false
-		for _, existingPeer := range chain.Nodes {
-			if existingPeer.IP.Equal(newPeer.IP) {
-				found = true
-				existingPeer.LastSeen = newPeer.LastSeen
-				existingPeer.NodeId = newPeer.NodeId
-				existingPeer.Lat = newPeer.Lat
-				existingPeer.Lon = newPeer.Lon
-				existingPeer.Moniker = newPeer.Moniker
-				existingPeer.Country = newPeer.Country
-				existingPeer.Region = newPeer.Region
-				existingPeer.City = newPeer.City
-				existingPeer.Isp = newPeer.Isp
-				existingPeer.As = newPeer.As
-				existingPeer.Org = newPeer.Org
-				break
-			}
-		}
-		if !found {
-			chain.Nodes = append(chain.Nodes, newPeer) // add new peer if not found
-		}
-	}
-	ResolvedPeers[chainId] = chain
-	logger.Info(fmt.Sprintf("We have %d total resolved peers for chain %s", len(ResolvedPeers[chainId].Nodes), cfg.Cfg.PrettyName))
+	total := ResolvedPeers.Upsert(chainId, geolocalizedPeers)
+	RefreshLiveness(cfg)
+	logger.Info(fmt.Sprintf("We have %d total resolved peers for chain %s", total, cfg.Cfg.PrettyName))
+	return err
 }
 
 func LoadSavedResolvedPeers(cfg seednode.SeedNodeConfig) {
-	chain := ResolvedPeers[cfg.Cfg.ChainId]
-	chain.ChainId = cfg.Cfg.ChainId
-	chain.PrettyName = cfg.Cfg.PrettyName
-	chain.Nodes = make([]GeolocalizedPeers, 0)
+	var nodes []GeolocalizedPeers
 
 	for _, address := range cfg.AddrBook.GetAddrbookContent() {
 		if address.Lat != 0 { // only add resolved nodes
@@ -136,159 +108,151 @@ func LoadSavedResolvedPeers(cfg seednode.SeedNodeConfig) {
 				IP:       address.Addr.IP,
 				Port:     address.Addr.Port,
 				LastSeen: address.LastSuccess,
-				Country:  address.Country,
-				Region:   address.Region,
-				City:     address.City,
-				Lat:      address.Lat,
-				Lon:      address.Lon,
-				Isp:      address.Isp,
-				Org:      address.Org,
-				As:       address.As,
-				NodeId:   address.ID(),
+				// the address book doesn't know when the peer was first seen, the last success is the oldest we have
+				FirstSeen:           address.LastSuccess,
+				LastAttempt:         address.LastAttempt,
+				ConsecutiveFailures: int(address.Attempts),
+				Country:             address.Country,
+				Region:              address.Region,
+				City:                address.City,
+				Lat:                 address.Lat,
+				Lon:                 address.Lon,
+				Isp:                 address.Isp,
+				Org:                 address.Org,
+				As:                  address.As,
+				NodeId:              address.ID(),
 			}
-			chain.Nodes = append(chain.Nodes, node)
+			nodes = append(nodes, node)
 		}
 	}
-	ResolvedPeers[cfg.Cfg.ChainId] = chain
-	logger.Info(fmt.Sprintf("Reloaded %d previously resolved peers from %s address book", len(chain.Nodes), cfg.Cfg.PrettyName))
+	ResolvedPeers.InitChain(cfg.Cfg.ChainId, cfg.Cfg.PrettyName, nodes)
+	RefreshLiveness(cfg)
+	logger.Info(fmt.Sprintf("Reloaded %d previously resolved peers from %s address book", len(nodes), cfg.Cfg.PrettyName))
 }
 
-func resolve(unresolvedPeers []*seednode.Peer) []GeolocalizedPeers {
-	chunkSize := 10
+// resolve geolocates the peers from the shared cache first, and calls the provider only for the remaining ones.
+// The requests are paced according to the provider quota. On a rate limit error, or when ctx is cancelled while waiting
+// for the next request, the peers resolved so far are returned
+func resolve(ctx context.Context, unresolvedPeers []*seednode.Peer) ([]GeolocalizedPeers, error) {
 	var geolocalizedPeers []GeolocalizedPeers
-	peersLength := len(unresolvedPeers)
+	var toLookup []*seednode.Peer
+
+	for _, peer := range unresolvedPeers {
+		if data, ok := cache.get(peer.IP); ok {
+			geolocalizedPeers = append(geolocalizedPeers, newGeolocalizedPeer(peer, data))
+		} else {
+			toLookup = append(toLookup, peer)
+		}
+	}
+	if len(geolocalizedPeers) > 0 {
+		logger.Info(fmt.Sprintf("Resolved %d peers from the geolocation cache", len(geolocalizedPeers)))
+		lookups.WithLabelValues(provider.Name(), "cache").Add(float64(len(geolocalizedPeers)))
+	}
+	defer cache.save()
+
+	chunkSize := provider.BatchSize()
+	peersLength := len(toLookup)
 
 	for i := 0; i < peersLength; i += chunkSize {
 		end := i + chunkSize
 		if end > peersLength {
 			end = peersLength
 		}
-		var chunk []*seednode.Peer
-		chunk = append(chunk, unresolvedPeers[i:end]...)
+		var chunk []net.IP
+		for _, peer := range toLookup[i:end] {
+			chunk = append(chunk, peer.IP)
+		}
 		if len(chunk) > 0 {
-			time.Sleep(1 * time.Second) // external service provider does not like fast queries...
-			ipServiceResponses := fillGeolocData(chunk)
-			var newGeolocalizedPeer GeolocalizedPeers
-			if ipServiceResponses == nil {
+			// external service provider does not like fast queries...
+			if err := sleep(ctx, pacingDelay()); err != nil {
+				return geolocalizedPeers, err
+			}
+			geolocData, err := provider.Lookup(ctx, chunk)
+			observeQuota()
+			if _, ok := err.(*RateLimitError); ok {
+				lookupErrors.WithLabelValues(provider.Name(), "rate_limit").Inc()
+				return geolocalizedPeers, err
+			} else if err != nil {
+				lookupErrors.WithLabelValues(provider.Name(), "error").Inc()
+				logger.Error(fmt.Sprintf("Geolocation provider %s returned an error: %s", provider.Name(), err.Error()))
 				continue
 			}
-			for _, elt := range ipServiceResponses {
-				if elt.Status != "success" {
-					continue
-				}
-				peer := findPeerInList(elt, unresolvedPeers)
+			lookups.WithLabelValues(provider.Name(), "provider").Add(float64(len(geolocData)))
+			for _, elt := range geolocData {
+				peer := findPeerInList(elt, toLookup)
 				if peer == nil {
 					logger.Error("Could not find peer in existing list! It may have not been resolved by the service")
 					continue
 				}
-				newGeolocalizedPeer = GeolocalizedPeers{
-					Moniker:  peer.Moniker,
-					LastSeen: peer.LastSeen,
-					Country:  elt.Country,
-					Region:   elt.Region,
-					City:     elt.City,
-					Lat:      elt.Lat,
-					Lon:      elt.Lon,
-					Isp:      elt.Isp,
-					Org:      elt.Org,
-					As:       elt.As,
-					NodeId:   peer.NodeId,
-					IP:       peer.IP,
-					Port:     peer.Port,
-				}
-				geolocalizedPeers = append(geolocalizedPeers, newGeolocalizedPeer)
+				cache.put(elt)
+				geolocalizedPeers = append(geolocalizedPeers, newGeolocalizedPeer(peer, elt))
 			}
 		}
 	}
-	return geolocalizedPeers
+	return geolocalizedPeers, nil
 }
 
-func fillGeolocData(chunk []*seednode.Peer) []ipServiceResponse {
-	logger.Info(fmt.Sprintf("Calling ip-api service with %d IPs", len(chunk)))
-	var ipList []string
-
-	for _, peer := range chunk {
-		ipList = append(ipList, (*peer).IP.String())
-	}
-
-	payload, err := json.Marshal(ipList)
-	if err != nil {
-		logger.Error("Failed to marshal peers list for geoloc service", err)
-		return nil
-	}
-
-	post, err := http.Post(ipApiUrl, jsonrpc.ContentType, bytes.NewBuffer(payload))
-	if err != nil {
-		logger.Error(fmt.Sprintf("IP geoloc service returned an error: %s", err.Error()))
-		return nil
+func newGeolocalizedPeer(peer *seednode.Peer, data GeolocData) GeolocalizedPeers {
+	geolocalizedPeer := GeolocalizedPeers{
+		Moniker:  peer.Moniker,
+		LastSeen: peer.LastSeen,
+		Country:  data.Country,
+		Region:   data.Region,
+		City:     data.City,
+		Lat:      data.Lat,
+		Lon:      data.Lon,
+		Isp:      data.Isp,
+		Org:      data.Org,
+		As:       data.As,
+		NodeId:   peer.NodeId,
+		IP:       peer.IP,
+		Port:     peer.Port,
 	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logger.Error("Error while waiting for response", err)
-		}
-	}(post.Body)
-
-	body, err := ioutil.ReadAll(post.Body)
-	if err != nil {
-		logger.Error("Error reading reponse", err)
-	}
-
-	//Decode the data
-	response := make([]ipServiceResponse, 0)
-	if err := json.Unmarshal(body, &response); err != nil {
-		logger.Error("Error while unmarshalling response", err)
+	if peer.NodeInfo != nil {
+		applyNodeInfo(&geolocalizedPeer, *peer.NodeInfo)
 	}
-
-	return response
+	return geolocalizedPeer
 }
 
-// We limit to 45 peers because of the rate limit of ip-api external service (45 per minute)
-func get45UnresolvedPeers(cfg seednode.SeedNodeConfig, chain string) []*seednode.Peer {
+// getUnresolvedPeers returns the connected peers and the address book entries which are not geolocated yet
+func getUnresolvedPeers(cfg seednode.SeedNodeConfig, chain string) []*seednode.Peer {
 	var peersToResolve []*seednode.Peer
+	// a connected peer is usually in the address book as well, it must be resolved only once
+	seenIds := make(map[types.NodeID]bool)
+	seenIPs := make(map[string]bool)
+	add := func(peer *seednode.Peer) {
+		if seenIds[peer.NodeId] || seenIPs[ipKey(peer.IP)] {
+			return
+		}
+		seenIds[peer.NodeId] = true
+		seenIPs[ipKey(peer.IP)] = true
+		peersToResolve = append(peersToResolve, peer)
+	}
 
 	for _, peer := range seednode.ToSeednodePeers(cfg.Sw.Peers().List()) {
-		if !isResolved(*peer, chain) {
-			peersToResolve = append(peersToResolve, peer)
-		}
-		if len(peersToResolve) == 45 {
-			break
+		if isGeolocatable(peer.IP) && !ResolvedPeers.IsResolved(chain, peer.IP) {
+			add(peer)
 		}
 	}
-	if len(peersToResolve) < 45 {
-		// fill with unresolved peers from address book
-		knownAddresses := getRandomPeersFromAddrBook(cfg.AddrBook.GetAddrbookContent())
-		for _, address := range knownAddresses {
-			if len(address.Country) == 0 {
-				peer := &seednode.Peer{
-					Moniker:  address.Moniker,
-					IP:       address.Addr.IP,
-					NodeId:   address.ID(),
-					LastSeen: address.LastSuccess,
-				}
-				peersToResolve = append(peersToResolve, peer)
-			}
-			if len(peersToResolve) == 45 {
-				break
-			}
+	// fill with unresolved peers from address book, in random order so we don't always pick the same ones
+	knownAddresses := getRandomPeersFromAddrBook(cfg.AddrBook.GetAddrbookContent())
+	for _, address := range knownAddresses {
+		if len(address.Country) == 0 && isGeolocatable(address.Addr.IP) {
+			add(&seednode.Peer{
+				Moniker:  address.Moniker,
+				IP:       address.Addr.IP,
+				Port:     address.Addr.Port,
+				NodeId:   address.ID(),
+				LastSeen: address.LastSuccess,
+			})
 		}
 	}
 	return peersToResolve // may be 0 size list if nothing new from pex reactor
 }
 
-func isResolved(peer seednode.Peer, chain string) bool {
-	for _, elt := range ResolvedPeers[chain].Nodes {
-		if elt.IP.String() == peer.IP.String() {
-			return true
-		}
-	}
-	return false
-}
-
-func findPeerInList(ipServiceResponse ipServiceResponse, peer []*seednode.Peer) *seednode.Peer {
+func findPeerInList(geolocData GeolocData, peer []*seednode.Peer) *seednode.Peer {
 	for _, elt := range peer {
-		if (*elt).IP.String() == ipServiceResponse.Query { // TODO: what on ipv6
+		if sameIP((*elt).IP, geolocData.IP) {
 			return elt
 		}
 	}
@@ -296,8 +260,6 @@ func findPeerInList(ipServiceResponse ipServiceResponse, peer []*seednode.Peer)
 }
 
 func getRandomPeersFromAddrBook(addrbook []*pex.KnownAddress) []*pex.KnownAddress {
-	// XXX: instead of making a list of all addresses, shuffling, and slicing a random chunk,
-	// could we just select a random numAddresses of indexes?
 	allAddr := make([]*pex.KnownAddress, 0)
 	for _, ka := range addrbook {
 		if ka.LastSuccess.Year() == 1 {
@@ -306,8 +268,7 @@ func getRandomPeersFromAddrBook(addrbook []*pex.KnownAddress) []*pex.KnownAddres
 		allAddr = append(allAddr, ka)
 	}
 
-	// Fisher-Yates shuffle the array. We only need to do the first
-	// `numAddresses' since we are throwing the rest.
+	// Fisher-Yates shuffle the array
 	len := len(allAddr)
 	for i := 0; i < len; i++ {
 		// pick a number between current index and the end
@@ -315,11 +276,17 @@ func getRandomPeersFromAddrBook(addrbook []*pex.KnownAddress) []*pex.KnownAddres
 		j := mrand.Intn(len-i) + i
 		allAddr[i], allAddr[j] = allAddr[j], allAddr[i]
 	}
+	return allAddr
+}
 
-	// slice off the limit we are willing to share.
-	max := len
-	if len > 45 {
-		max = 45
+// sleep waits for the given duration, or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return allAddr[:max]
 }
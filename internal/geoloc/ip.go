@@ -0,0 +1,46 @@
+package geoloc
+
+import (
+	"net"
+	"strings"
+)
+
+// normalizeIP returns the canonical form of an IP: 4 bytes for IPv4 and IPv4-mapped IPv6, 16 bytes for IPv6
+func normalizeIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip.To16()
+}
+
+// parseIP parses an IPv4 or IPv6 address, with or without brackets and zone (i.e. "[fe80::1%eth0]")
+func parseIP(s string) net.IP {
+	s = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "["), "]")
+	if i := strings.IndexByte(s, '%'); i >= 0 {
+		s = s[:i]
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil
+	}
+	return normalizeIP(ip)
+}
+
+// ipKey is the canonical string representation of an IP, used to compare and index IPs
+func ipKey(ip net.IP) string {
+	normalized := normalizeIP(ip)
+	if normalized == nil {
+		return ""
+	}
+	return normalized.String()
+}
+
+func sameIP(a net.IP, b net.IP) bool {
+	return a != nil && b != nil && normalizeIP(a).Equal(normalizeIP(b))
+}
+
+// isGeolocatable is true for the public unicast IPs, others can't be resolved by any provider
+func isGeolocatable(ip net.IP) bool {
+	ip = normalizeIP(ip)
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
@@ -0,0 +1,95 @@
+package geoloc
+
+import (
+	"net"
+	"testing"
+)
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   net.IP
+		want int // length of the normalized IP, 0 for nil
+	}{
+		{"IPv4", net.IPv4(8, 8, 8, 8).To4(), net.IPv4len},
+		{"IPv4 in 16 bytes", net.IPv4(8, 8, 8, 8), net.IPv4len},
+		{"IPv4-mapped IPv6", net.ParseIP("::ffff:8.8.8.8"), net.IPv4len},
+		{"IPv6", net.ParseIP("2001:4860:4860::8888"), net.IPv6len},
+		{"nil", nil, 0},
+		{"invalid length", net.IP{1, 2, 3}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeIP(tt.ip); len(got) != tt.want {
+				t.Errorf("normalizeIP(%v) = %v of %d bytes, want %d bytes", tt.ip, got, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIP(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string // canonical form, empty if invalid
+	}{
+		{"IPv4", "8.8.8.8", "8.8.8.8"},
+		{"spaces", " 8.8.8.8 ", "8.8.8.8"},
+		{"IPv4-mapped IPv6", "::ffff:8.8.8.8", "8.8.8.8"},
+		{"IPv4-mapped IPv6 in brackets", "[::ffff:8.8.8.8]", "8.8.8.8"},
+		{"IPv6", "2001:4860:4860::8888", "2001:4860:4860::8888"},
+		{"IPv6 in brackets", "[2001:4860:4860::8888]", "2001:4860:4860::8888"},
+		{"zoned IPv6", "fe80::1%eth0", "fe80::1"},
+		{"zoned IPv6 in brackets", "[fe80::1%eth0]", "fe80::1"},
+		{"hostname", "example.com", ""},
+		{"with port", "8.8.8.8:26656", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipKey(parseIP(tt.s)); got != tt.want {
+				t.Errorf("parseIP(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameIP(t *testing.T) {
+	if !sameIP(net.ParseIP("::ffff:8.8.8.8"), net.IPv4(8, 8, 8, 8).To4()) {
+		t.Error("an IPv4-mapped IPv6 differs from its IPv4")
+	}
+	if sameIP(nil, nil) {
+		t.Error("nil IPs are the same")
+	}
+}
+
+func TestIsGeolocatable(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		want bool
+	}{
+		{"public IPv4", "8.8.8.8", true},
+		{"public IPv4-mapped IPv6", "::ffff:8.8.8.8", true},
+		{"public IPv6", "2001:4860:4860::8888", true},
+		{"private IPv4", "192.168.1.1", false},
+		{"private IPv4 10/8", "10.0.0.1", false},
+		{"private IPv4-mapped IPv6", "::ffff:172.16.0.1", false},
+		{"private IPv6", "fd00::1", false},
+		{"loopback IPv4", "127.0.0.1", false},
+		{"loopback IPv6", "::1", false},
+		{"link-local IPv4", "169.254.1.1", false},
+		{"link-local IPv6", "fe80::1", false},
+		{"zoned link-local IPv6", "fe80::1%eth0", false},
+		{"unspecified", "0.0.0.0", false},
+		{"multicast", "224.0.0.1", false},
+		{"invalid", "example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isGeolocatable(parseIP(tt.ip)); got != tt.want {
+				t.Errorf("isGeolocatable(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package geoloc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-kit/kit/transport/http/jsonrpc"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ipApiUrl = "http://ip-api.com/batch"
+)
+
+const ipApiTimeout = 30 * time.Second // a hung request must not stall the scheduler
+
+type ipServiceResponse struct {
+	Status      string  `json:"status"`
+	Country     string  `json:"country"`
+	CountryCode string  `json:"country_code"`
+	Region      string  `json:"region"`
+	RegionName  string  `json:"region_name"`
+	City        string  `json:"city"`
+	Zip         string  `json:"zip"`
+	Lat         float32 `json:"lat"`
+	Lon         float32 `json:"lon"`
+	Timezone    string  `json:"timezone"`
+	Isp         string  `json:"isp"`
+	Org         string  `json:"org"`
+	As          string  `json:"as"`
+	Query       string  `json:"Query"`
+}
+
+/*
+ipApiProvider uses the https://ip-api.com/ batch endpoint of the free service.
+The service reports its remaining quota in the X-Rl (requests left) and X-Ttl (seconds until reset) headers
+*/
+type ipApiProvider struct {
+	url    string
+	client *http.Client
+
+	mtx   sync.Mutex
+	quota Quota
+}
+
+func newIpApiProvider() *ipApiProvider {
+	return &ipApiProvider{url: ipApiUrl, client: &http.Client{Timeout: ipApiTimeout}}
+}
+
+func (p *ipApiProvider) Name() string {
+	return IpApiProviderName
+}
+
+// BatchSize is kept low, the free service does not like big batches
+func (p *ipApiProvider) BatchSize() int {
+	return 10
+}
+
+// RateLimit of the batch endpoint of the free service is 15 requests per minute, whatever the number of IPs
+func (p *ipApiProvider) RateLimit() int {
+	return 15
+}
+
+func (p *ipApiProvider) Quota() Quota {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.quota
+}
+
+func (p *ipApiProvider) updateQuota(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-Rl"))
+	if err != nil {
+		return
+	}
+	ttl, err := strconv.Atoi(header.Get("X-Ttl"))
+	if err != nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.quota = Quota{
+		Known:     true,
+		Remaining: remaining,
+		ResetAt:   time.Now().Add(time.Duration(ttl) * time.Second),
+	}
+}
+
+func (p *ipApiProvider) Lookup(ctx context.Context, ips []net.IP) ([]GeolocData, error) {
+	logger.Info(fmt.Sprintf("Calling ip-api service with %d IPs", len(ips)))
+	var ipList []string
+
+	for _, ip := range ips {
+		ipList = append(ipList, ipKey(ip))
+	}
+
+	payload, err := json.Marshal(ipList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal peers list for geoloc service: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewBuffer(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the geoloc service request: %w", err)
+	}
+	request.Header.Set("Content-Type", jsonrpc.ContentType)
+	post, err := p.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("IP geoloc service returned an error: %w", err)
+	}
+
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logger.Error("Error while waiting for response", err)
+		}
+	}(post.Body)
+
+	p.updateQuota(post.Header)
+	if post.StatusCode == http.StatusTooManyRequests {
+		ttl, _ := strconv.Atoi(post.Header.Get("X-Ttl"))
+		return nil, &RateLimitError{RetryAfter: time.Duration(ttl) * time.Second}
+	}
+
+	body, err := ioutil.ReadAll(post.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	//Decode the data
+	response := make([]ipServiceResponse, 0)
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error while unmarshalling response: %w", err)
+	}
+
+	var result []GeolocData
+	for _, elt := range response {
+		if elt.Status != "success" {
+			continue
+		}
+		result = append(result, GeolocData{
+			IP:      parseIP(elt.Query),
+			Country: elt.Country,
+			Region:  elt.Region,
+			City:    elt.City,
+			Lat:     elt.Lat,
+			Lon:     elt.Lon,
+			Isp:     elt.Isp,
+			Org:     elt.Org,
+			As:      elt.As,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package geoloc
+
+import (
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"time"
+)
+
+type PeerStatus string
+
+const (
+	PeerOnline PeerStatus = "online" // connected, or seen very recently as the seed disconnects peers quickly
+	PeerStale  PeerStatus = "stale"  // not seen for a while, or failing to connect
+	PeerDead   PeerStatus = "dead"   // not seen for a long time
+
+	onlineWindow      = 1 * time.Hour
+	deadAfter         = 7 * 24 * time.Hour
+	maxFailuresOnline = 3
+)
+
+// Reachability tells whether a peer accepts inbound connections, as found by the prober
+type Reachability string
+
+const (
+	ReachabilityUnknown Reachability = "unknown"     // not probed yet
+	Reachable           Reachability = "reachable"   // public node
+	Unreachable         Reachability = "unreachable" // behind a NAT or a firewall, or offline
+)
+
+/*
+RefreshLiveness updates the liveness of the geolocalized peers of a chain from the switch (connected peers),
+the address book (last success, last attempt and consecutive failed attempts) and the last probes
+*/
+func RefreshLiveness(cfg seednode.SeedNodeConfig) {
+	now := time.Now()
+	connected := make(map[types.NodeID]bool)
+	for _, peer := range cfg.Sw.Peers().List() {
+		connected[peer.ID()] = true
+	}
+	addresses := make(map[types.NodeID]*pex.KnownAddress)
+	for _, address := range cfg.AddrBook.GetAddrbookContent() {
+		addresses[address.ID()] = address
+	}
+	var probes map[types.NodeID]seednode.ProbeResult
+	if cfg.Prober != nil {
+		probes = cfg.Prober.Results()
+	}
+	var nodeInfos map[types.NodeID]seednode.PeerNodeInfo
+	if cfg.NodeInfos != nil {
+		nodeInfos = cfg.NodeInfos.All()
+	}
+
+	ResolvedPeers.Update(cfg.Cfg.ChainId, func(peer *GeolocalizedPeers) {
+		if connected[peer.NodeId] {
+			peer.LastSeen = now
+			peer.ConsecutiveFailures = 0
+		}
+		if address, ok := addresses[peer.NodeId]; ok && sameIP(address.Addr.IP, peer.IP) {
+			if address.LastSuccess.After(peer.LastSeen) {
+				peer.LastSeen = address.LastSuccess
+			}
+			if address.LastAttempt.After(peer.LastAttempt) {
+				peer.LastAttempt = address.LastAttempt
+			}
+			if !connected[peer.NodeId] {
+				peer.ConsecutiveFailures = int(address.Attempts)
+			}
+		}
+		if !peer.LastSeen.IsZero() && (peer.FirstSeen.IsZero() || peer.LastSeen.Before(peer.FirstSeen)) {
+			peer.FirstSeen = peer.LastSeen
+		}
+		peer.Status = peerStatus(*peer, connected[peer.NodeId], now)
+		if probe, ok := probes[peer.NodeId]; ok && sameIP(probe.IP, peer.IP) {
+			applyProbe(peer, probe)
+		} else if peer.Reachability == "" {
+			peer.Reachability = ReachabilityUnknown
+		}
+		if nodeInfo, ok := nodeInfos[peer.NodeId]; ok {
+			applyNodeInfo(peer, nodeInfo)
+		}
+	})
+}
+
+func applyProbe(peer *GeolocalizedPeers, probe seednode.ProbeResult) {
+	probedAt := probe.ProbedAt
+	peer.LastProbe = &probedAt
+	peer.Reachability = Unreachable
+	peer.HandshakeMs = 0
+	if probe.Reachable {
+		peer.Reachability = Reachable
+		peer.HandshakeMs = probe.Latency.Milliseconds()
+	}
+}
+
+// applyNodeInfo copies the last NodeInfo reported by the node, from a connection or a probe
+func applyNodeInfo(peer *GeolocalizedPeers, nodeInfo seednode.PeerNodeInfo) {
+	peer.Version = nodeInfo.Version
+	peer.P2PVersion = nodeInfo.ProtocolVersion.P2P
+	peer.BlockVersion = nodeInfo.ProtocolVersion.Block
+	peer.AppVersion = nodeInfo.ProtocolVersion.App
+	peer.Network = nodeInfo.Network
+	peer.Channels = nodeInfo.Channels
+	peer.TxIndex = nodeInfo.TxIndex
+	peer.RPCAddress = nodeInfo.RPCAddress
+	if peer.Moniker == "" {
+		peer.Moniker = nodeInfo.Moniker
+	}
+}
+
+func peerStatus(peer GeolocalizedPeers, connected bool, now time.Time) PeerStatus {
+	switch {
+	case connected:
+		return PeerOnline
+	case peer.LastSeen.IsZero() || now.Sub(peer.LastSeen) > deadAfter:
+		return PeerDead
+	case now.Sub(peer.LastSeen) <= onlineWindow && peer.ConsecutiveFailures < maxFailuresOnline:
+		return PeerOnline
+	default:
+		return PeerStale
+	}
+}
@@ -0,0 +1,40 @@
+package geoloc
+
+import (
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the provider quota is shared by all the chains, so these metrics are labelled by provider only
+var (
+	lookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: seednode.MetricsNamespace,
+		Subsystem: "geoloc",
+		Name:      "lookups_total",
+		Help:      "Number of IPs geolocated, from the cache or the provider.",
+	}, []string{"provider", "source"})
+	lookupErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: seednode.MetricsNamespace,
+		Subsystem: "geoloc",
+		Name:      "errors_total",
+		Help:      "Number of failed requests to the geolocation provider.",
+	}, []string{"provider", "reason"})
+	quotaRemaining = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: seednode.MetricsNamespace,
+		Subsystem: "geoloc",
+		Name:      "quota_remaining",
+		Help:      "Remaining requests in the current rate limit window of the provider, -1 if unknown.",
+	}, []string{"provider"})
+)
+
+func init() {
+	prometheus.MustRegister(lookups, lookupErrors, quotaRemaining)
+}
+
+func observeQuota() {
+	remaining, known := provider.Quota().Current()
+	if !known {
+		remaining = -1
+	}
+	quotaRemaining.WithLabelValues(provider.Name()).Set(float64(remaining))
+}
@@ -0,0 +1,170 @@
+package geoloc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type mmdbCityRecord struct {
+	Country struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+type mmdbAsnRecord struct {
+	AutonomousSystemNumber       uint   `maxminddb:"autonomous_system_number"`
+	AutonomousSystemOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+/*
+mmdbProvider resolves IPs offline from local MaxMind GeoLite2 or DB-IP lite .mmdb files.
+The city database is mandatory, the ASN database is optional (GeoLite2 ships it as a separate file).
+The files are reopened whenever their modification time changes, so they can be updated in place.
+*/
+type mmdbProvider struct {
+	city *mmdbFile
+	asn  *mmdbFile
+}
+
+// mmdbFile is a .mmdb reader reloaded when the file changes on disk
+type mmdbFile struct {
+	mtx     sync.Mutex
+	path    string
+	modTime time.Time
+	reader  *maxminddb.Reader
+}
+
+func newMmdbProvider(cityPath string, asnPath string) (*mmdbProvider, error) {
+	if cityPath == "" {
+		return nil, errors.New("mmdb provider requires geoloc.mmdb_path to be set")
+	}
+	p := &mmdbProvider{city: &mmdbFile{path: cityPath}}
+	if err := p.city.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	if asnPath != "" {
+		p.asn = &mmdbFile{path: asnPath}
+		if err := p.asn.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *mmdbProvider) Name() string {
+	return MmdbProviderName
+}
+
+func (p *mmdbProvider) BatchSize() int {
+	return 100
+}
+
+// RateLimit is unlimited, everything is resolved locally
+func (p *mmdbProvider) RateLimit() int {
+	return 0
+}
+
+func (p *mmdbProvider) Quota() Quota {
+	return Quota{}
+}
+
+// Lookup reads the local databases, which is fast enough not to check ctx
+func (p *mmdbProvider) Lookup(_ context.Context, ips []net.IP) ([]GeolocData, error) {
+	if err := p.city.reloadIfChanged(); err != nil {
+		logger.Error("Could not reload mmdb file, keeping the previous one: " + err.Error())
+	}
+	if p.asn != nil {
+		if err := p.asn.reloadIfChanged(); err != nil {
+			logger.Error("Could not reload mmdb file, keeping the previous one: " + err.Error())
+		}
+	}
+
+	var result []GeolocData
+	for _, ip := range ips {
+		var city mmdbCityRecord
+		found, err := p.city.lookup(ip, &city)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		data := GeolocData{
+			IP:      normalizeIP(ip),
+			Country: city.Country.Names["en"],
+			City:    city.City.Names["en"],
+			Lat:     float32(city.Location.Latitude),
+			Lon:     float32(city.Location.Longitude),
+		}
+		if len(city.Subdivisions) > 0 {
+			data.Region = city.Subdivisions[0].Names["en"]
+		}
+		if p.asn != nil {
+			var asn mmdbAsnRecord
+			found, err := p.asn.lookup(ip, &asn)
+			if err != nil {
+				return nil, err
+			}
+			if found && asn.AutonomousSystemNumber != 0 {
+				// same format as ip-api
+				data.As = fmt.Sprintf("AS%d %s", asn.AutonomousSystemNumber, asn.AutonomousSystemOrganization)
+				data.Org = asn.AutonomousSystemOrganization
+				data.Isp = asn.AutonomousSystemOrganization
+			}
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+func (f *mmdbFile) reloadIfChanged() error {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if f.reader != nil && stat.ModTime().Equal(f.modTime) {
+		return nil
+	}
+
+	reader, err := maxminddb.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to open mmdb file %s: %w", f.path, err)
+	}
+	if f.reader != nil {
+		_ = f.reader.Close()
+		logger.Info("Reloaded mmdb file " + f.path)
+	}
+	f.reader = reader
+	f.modTime = stat.ModTime()
+	return nil
+}
+
+func (f *mmdbFile) lookup(ip net.IP, result interface{}) (bool, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	_, found, err := f.reader.LookupNetwork(ip, result)
+	if err != nil {
+		return false, fmt.Errorf("mmdb lookup failed for %s: %w", ip.String(), err)
+	}
+	return found, nil
+}
@@ -0,0 +1,160 @@
+package geoloc
+
+import (
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+PeerStore holds the geolocalized peers of every chain. It is written by the geolocation scheduler and read
+concurrently by the web server, so every access goes through its lock and readers only get copies.
+Peers are keyed by node ID and IP: a node changing IP, or several nodes behind the same IP, are distinct entries.
+*/
+type PeerStore struct {
+	mtx    sync.RWMutex
+	chains map[string]*storedChain
+}
+
+type storedChain struct {
+	Chain
+	index map[string]int // peerKey -> position in Nodes
+}
+
+func NewPeerStore() *PeerStore {
+	return &PeerStore{chains: make(map[string]*storedChain)}
+}
+
+func peerKey(nodeId types.NodeID, ip net.IP) string {
+	return string(nodeId) + "@" + ipKey(ip)
+}
+
+// InitChain registers a chain, replacing its peers with the given ones
+func (s *PeerStore) InitChain(chainId string, prettyName string, peers []GeolocalizedPeers) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	chain := &storedChain{
+		Chain: Chain{
+			ChainId:    chainId,
+			PrettyName: prettyName,
+			Nodes:      make([]GeolocalizedPeers, 0, len(peers)),
+		},
+		index: make(map[string]int),
+	}
+	s.chains[chainId] = chain
+	chain.upsert(peers)
+}
+
+// RemoveChain forgets a chain and its peers
+func (s *PeerStore) RemoveChain(chainId string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.chains, chainId)
+}
+
+// Upsert adds the new peers of a chain and updates the existing ones. Returns the number of peers of the chain
+func (s *PeerStore) Upsert(chainId string, peers []GeolocalizedPeers) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	chain, ok := s.chains[chainId]
+	if !ok {
+		chain = &storedChain{
+			Chain: Chain{ChainId: chainId, Nodes: make([]GeolocalizedPeers, 0)},
+			index: make(map[string]int),
+		}
+		s.chains[chainId] = chain
+	}
+	chain.upsert(peers)
+	return len(chain.Nodes)
+}
+
+// Update applies fn to every peer of a chain
+func (s *PeerStore) Update(chainId string, fn func(peer *GeolocalizedPeers)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	chain, ok := s.chains[chainId]
+	if !ok {
+		return
+	}
+	for i := range chain.Nodes {
+		fn(&chain.Nodes[i])
+	}
+}
+
+// upsert keeps the liveness history of the existing peers, which is not known by the resolver
+func (c *storedChain) upsert(peers []GeolocalizedPeers) {
+	for _, peer := range peers {
+		key := peerKey(peer.NodeId, peer.IP)
+		if i, ok := c.index[key]; ok {
+			existing := c.Nodes[i]
+			peer.FirstSeen = existing.FirstSeen
+			if existing.LastSeen.After(peer.LastSeen) {
+				peer.LastSeen = existing.LastSeen
+			}
+			if existing.LastAttempt.After(peer.LastAttempt) {
+				peer.LastAttempt = existing.LastAttempt
+			}
+			peer.ConsecutiveFailures = existing.ConsecutiveFailures
+			peer.Status = existing.Status
+			c.Nodes[i] = peer
+		} else {
+			if peer.FirstSeen.IsZero() {
+				peer.FirstSeen = time.Now()
+			}
+			c.index[key] = len(c.Nodes)
+			c.Nodes = append(c.Nodes, peer)
+		}
+	}
+}
+
+// IsResolved is true if a peer of the chain with the same IP is already geolocalized
+func (s *PeerStore) IsResolved(chainId string, ip net.IP) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	chain, ok := s.chains[chainId]
+	if !ok {
+		return false
+	}
+	for _, peer := range chain.Nodes {
+		if sameIP(peer.IP, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Chain returns a copy of a chain and its peers
+func (s *PeerStore) Chain(chainId string) (Chain, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	chain, ok := s.chains[chainId]
+	if !ok {
+		return Chain{}, false
+	}
+	return chain.copy(), true
+}
+
+// Snapshot returns a copy of all the chains, keyed by chain id
+func (s *PeerStore) Snapshot() map[string]Chain {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	snapshot := make(map[string]Chain, len(s.chains))
+	for chainId, chain := range s.chains {
+		snapshot[chainId] = chain.copy()
+	}
+	return snapshot
+}
+
+func (c *storedChain) copy() Chain {
+	chain := c.Chain
+	chain.Nodes = make([]GeolocalizedPeers, len(c.Nodes))
+	copy(chain.Nodes, c.Nodes)
+	return chain
+}
@@ -0,0 +1,82 @@
+package geoloc
+
+import (
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUpsert(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	nodeId := types.NodeID("0000000000000000000000000000000000000001")
+	existing := GeolocalizedPeers{
+		Moniker:             "validator",
+		IP:                  net.IPv4(8, 8, 8, 8).To4(),
+		NodeId:              nodeId,
+		FirstSeen:           now.Add(-48 * time.Hour),
+		LastSeen:            now.Add(-time.Hour),
+		LastAttempt:         now.Add(-time.Minute),
+		ConsecutiveFailures: 2,
+		Status:              PeerStale,
+		Country:             "United States",
+		City:                "Mountain View",
+		As:                  "AS15169 Google LLC",
+	}
+	// as resolved again: the geolocation comes from the cache, the liveness is unknown
+	resolved := func(ip net.IP, lastSeen time.Time) GeolocalizedPeers {
+		return GeolocalizedPeers{Moniker: "validator-2", IP: ip, NodeId: nodeId, LastSeen: lastSeen,
+			Country: existing.Country, City: existing.City, As: existing.As}
+	}
+
+	tests := []struct {
+		name         string
+		peer         GeolocalizedPeers
+		want         int       // peers of the chain
+		wantLastSeen time.Time // of the entry at the key of peer
+		newEntry     bool
+	}{
+		{"seen again", resolved(existing.IP, now), 1, now, false},
+		{"seen again by an older source", resolved(existing.IP, now.Add(-2*time.Hour)), 1, existing.LastSeen, false},
+		{"seen again on the IPv4-mapped IPv6", resolved(net.ParseIP("::ffff:8.8.8.8"), now), 1, now, false},
+		{"new IP", resolved(net.IPv4(8, 8, 4, 4).To4(), now), 2, now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewPeerStore()
+			store.InitChain("cosmoshub-4", "Cosmos Hub", []GeolocalizedPeers{existing})
+			if total := store.Upsert("cosmoshub-4", []GeolocalizedPeers{tt.peer}); total != tt.want {
+				t.Fatalf("Upsert() = %d peers, want %d", total, tt.want)
+			}
+
+			chain, _ := store.Chain("cosmoshub-4")
+			peers := make(map[string]GeolocalizedPeers)
+			for _, peer := range chain.Nodes {
+				peers[peerKey(peer.NodeId, peer.IP)] = peer
+			}
+			got, ok := peers[peerKey(tt.peer.NodeId, tt.peer.IP)]
+			if !ok {
+				t.Fatalf("no peer at %s", peerKey(tt.peer.NodeId, tt.peer.IP))
+			}
+			if got.Moniker != tt.peer.Moniker || !got.LastSeen.Equal(tt.wantLastSeen) {
+				t.Errorf("moniker, last seen = %s, %s, want %s, %s", got.Moniker, got.LastSeen, tt.peer.Moniker, tt.wantLastSeen)
+			}
+			if got.Country != existing.Country || got.City != existing.City || got.As != existing.As {
+				t.Errorf("geolocation = %s, %s, %s, want the one of %+v", got.Country, got.City, got.As, existing)
+			}
+
+			if tt.newEntry {
+				if got.FirstSeen.Before(now) || got.ConsecutiveFailures != 0 || got.Status != "" {
+					t.Errorf("liveness of the new entry = %+v, want a new one", got)
+				}
+				if old := peers[peerKey(existing.NodeId, existing.IP)]; old.Moniker != existing.Moniker ||
+					!old.LastSeen.Equal(existing.LastSeen) || old.Status != existing.Status {
+					t.Errorf("entry on the previous IP = %+v, want it unchanged", old)
+				}
+			} else if !got.FirstSeen.Equal(existing.FirstSeen) || !got.LastAttempt.Equal(existing.LastAttempt) ||
+				got.ConsecutiveFailures != existing.ConsecutiveFailures || got.Status != existing.Status {
+				t.Errorf("liveness = %+v, want the one of %+v", got, existing)
+			}
+		})
+	}
+}
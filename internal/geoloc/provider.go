@@ -0,0 +1,92 @@
+package geoloc
+
+import (
+	"context"
+	"fmt"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"net"
+	"time"
+)
+
+const (
+	IpApiProviderName = "ip-api"
+	MmdbProviderName  = "mmdb"
+)
+
+var (
+	provider GeolocProvider
+)
+
+// GeolocProvider is a geolocation backend able to resolve a batch of IPs
+type GeolocProvider interface {
+	// Name of the provider, as set in the config file
+	Name() string
+	// BatchSize is the max number of IPs that can be given to a single Lookup call
+	BatchSize() int
+	// RateLimit is the max number of Lookup requests per minute, counted like the Quota, 0 means unlimited
+	RateLimit() int
+	// Quota is the remaining quota as last reported by the service
+	Quota() Quota
+	// Lookup resolves the given IPs. IPs that could not be resolved are omitted from the result.
+	// A *RateLimitError is returned when the service rejected the request because of its rate limit.
+	// The lookup is abandoned when ctx is cancelled
+	Lookup(ctx context.Context, ips []net.IP) ([]GeolocData, error)
+}
+
+// Quota is the number of requests a provider accepts until its rate limit window resets
+type Quota struct {
+	Known     bool
+	Remaining int
+	ResetAt   time.Time
+}
+
+// Current returns the remaining requests, or false if the quota is unknown or its window is over
+func (q Quota) Current() (int, bool) {
+	if !q.Known || time.Now().After(q.ResetAt) {
+		return 0, false
+	}
+	return q.Remaining, true
+}
+
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// GeolocData is the provider-agnostic result of a lookup
+type GeolocData struct {
+	IP      net.IP  `json:"ip"`
+	Country string  `json:"country"`
+	Region  string  `json:"region"`
+	City    string  `json:"city"`
+	Lat     float32 `json:"lat"`
+	Lon     float32 `json:"lon"`
+	Isp     string  `json:"isp"`
+	Org     string  `json:"org"`
+	As      string  `json:"as"`
+}
+
+// InitProvider selects the geolocation backend configured in the [geoloc] section
+func InitProvider(cfg config.GeolocConfig) error {
+	p, err := NewProvider(cfg)
+	if err != nil {
+		return err
+	}
+	provider = p
+	logger.Info("Using geolocation provider " + p.Name())
+	return nil
+}
+
+func NewProvider(cfg config.GeolocConfig) (GeolocProvider, error) {
+	switch cfg.Provider {
+	case "", IpApiProviderName:
+		return newIpApiProvider(), nil
+	case MmdbProviderName:
+		return newMmdbProvider(cfg.MmdbPath, cfg.MmdbAsnPath)
+	default:
+		return nil, fmt.Errorf("unknown geolocation provider: %s", cfg.Provider)
+	}
+}
@@ -0,0 +1,193 @@
+package geoloc
+
+import (
+	"context"
+	"fmt"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"time"
+)
+
+const (
+	defaultResolveInterval = 60 * time.Second // ip-api rate limit window
+	minBackoff             = 5 * time.Second
+	maxBackoff             = 10 * time.Minute
+)
+
+/*
+Scheduler runs the geolocation of all the chains periodically.
+On each round, the quota of the provider is shared fairly between the chains having unresolved peers,
+the first chain to be served rotating on every round. Peers found in the cache don't use any quota.
+When the provider is rate limited, the scheduler waits for the reported reset time or backs off exponentially.
+*/
+type Scheduler struct {
+	seedNodes func() []seednode.SeedNodeConfig // running seed nodes, chains can be added or removed at runtime
+	interval  time.Duration
+	trigger   chan struct{}
+	next      int // index of the chain served first on the next round
+	backoff   time.Duration
+}
+
+type chainWork struct {
+	cfg      seednode.SeedNodeConfig
+	cached   []*seednode.Peer
+	uncached []*seednode.Peer
+	allotted int
+}
+
+func NewScheduler(seedNodes func() []seednode.SeedNodeConfig, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+	return &Scheduler{
+		seedNodes: seedNodes,
+		interval:  interval,
+		trigger:   make(chan struct{}, 1),
+	}
+}
+
+// Run resolves the peers until ctx is cancelled, the first round starts immediately
+func (s *Scheduler) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		timer := time.NewTimer(s.round(ctx))
+		select {
+		case <-timer.C:
+		case <-s.trigger:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+}
+
+// Trigger starts a new round without waiting for the next tick
+func (s *Scheduler) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default: // a round is already pending
+	}
+}
+
+// round resolves a share of the unresolved peers of every chain and returns the delay before the next round.
+// It returns early when ctx is cancelled, keeping the peers resolved so far
+func (s *Scheduler) round(ctx context.Context) time.Duration {
+	seedNodes := s.seedNodes()
+	if len(seedNodes) == 0 {
+		return s.interval
+	}
+
+	works := make([]*chainWork, len(seedNodes))
+	for i, cfg := range seedNodes {
+		work := &chainWork{cfg: cfg}
+		for _, peer := range getUnresolvedPeers(cfg, cfg.Cfg.ChainId) {
+			if cache.has(peer.IP) {
+				work.cached = append(work.cached, peer)
+			} else {
+				work.uncached = append(work.uncached, peer)
+			}
+		}
+		works[i] = work
+	}
+	first := s.next % len(works)
+	s.next = (first + 1) % len(works)
+	distributeBudget(works, budget(), provider.BatchSize(), first)
+
+	for i := range works {
+		work := works[(first+i)%len(works)]
+		peers := append(work.cached, work.uncached[:work.allotted]...)
+		if len(peers) == 0 {
+			work.cfg.Health.GeolocDone() // nothing to resolve for now
+			continue
+		}
+		if err := resolveChain(ctx, work.cfg, peers); err != nil {
+			if ctx.Err() != nil {
+				return s.interval // shutting down
+			}
+			if rateLimitErr, ok := err.(*RateLimitError); ok {
+				return s.onRateLimited(rateLimitErr)
+			}
+			logger.Error(fmt.Sprintf("Failed to resolve peers of chain %s: %s", work.cfg.Cfg.PrettyName, err.Error()))
+			continue
+		}
+		work.cfg.Health.GeolocDone()
+	}
+	s.backoff = 0
+
+	if remaining, known := provider.Quota().Current(); known && remaining <= 0 {
+		if wait := time.Until(provider.Quota().ResetAt); wait > s.interval {
+			return wait
+		}
+	}
+	return s.interval
+}
+
+func (s *Scheduler) onRateLimited(err *RateLimitError) time.Duration {
+	if err.RetryAfter > 0 {
+		s.backoff = err.RetryAfter
+	} else if s.backoff < minBackoff {
+		s.backoff = minBackoff
+	} else {
+		s.backoff *= 2
+	}
+	if s.backoff > maxBackoff {
+		s.backoff = maxBackoff
+	}
+	logger.Info(fmt.Sprintf("Geolocation provider %s is rate limited, next round in %s", provider.Name(), s.backoff))
+	return s.backoff
+}
+
+// budget is the number of requests the provider accepts now, or -1 if it is unlimited.
+// A round runs once per rate limit window, so the rate limit is the budget while the quota is unknown
+func budget() int {
+	if remaining, known := provider.Quota().Current(); known {
+		return remaining
+	}
+	if provider.RateLimit() == 0 {
+		return -1
+	}
+	return provider.RateLimit()
+}
+
+// distributeBudget shares the requests one batch at a time between the chains still having uncached peers,
+// starting from the chain at index first, so unused shares go to the chains that need more.
+// Each request allots batchSize IPs, this is the only place requests are converted to IPs
+func distributeBudget(works []*chainWork, budget int, batchSize int, first int) {
+	if budget < 0 {
+		for _, work := range works {
+			work.allotted = len(work.uncached)
+		}
+		return
+	}
+	for budget > 0 {
+		served := false
+		for i := range works {
+			work := works[(first+i)%len(works)]
+			if budget > 0 && work.allotted < len(work.uncached) {
+				work.allotted += batchSize
+				if work.allotted > len(work.uncached) {
+					work.allotted = len(work.uncached)
+				}
+				budget--
+				served = true
+			}
+		}
+		if !served {
+			return
+		}
+	}
+}
+
+// pacingDelay spreads the remaining requests of the provider evenly until its quota resets, or over the minute of its
+// rate limit while the quota is unknown
+func pacingDelay() time.Duration {
+	if remaining, known := provider.Quota().Current(); known {
+		untilReset := time.Until(provider.Quota().ResetAt)
+		if remaining <= 0 {
+			return untilReset
+		}
+		return untilReset / time.Duration(remaining+1)
+	}
+	if provider.RateLimit() > 0 {
+		return time.Minute / time.Duration(provider.RateLimit())
+	}
+	return 0
+}
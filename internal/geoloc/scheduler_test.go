@@ -0,0 +1,121 @@
+package geoloc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeProvider reports a fixed rate limit and quota
+type fakeProvider struct {
+	rateLimit int
+	quota     Quota
+}
+
+func (p *fakeProvider) Name() string   { return "fake" }
+func (p *fakeProvider) BatchSize() int { return 10 }
+func (p *fakeProvider) RateLimit() int { return p.rateLimit }
+func (p *fakeProvider) Quota() Quota   { return p.quota }
+
+func (p *fakeProvider) Lookup(_ context.Context, _ []net.IP) ([]GeolocData, error) {
+	return nil, nil
+}
+
+func TestPacingDelay(t *testing.T) {
+	defer func(p GeolocProvider) { provider = p }(provider)
+
+	tests := []struct {
+		name      string
+		rateLimit int
+		quota     Quota
+		min, max  time.Duration
+	}{
+		{"unlimited", 0, Quota{}, 0, 0},
+		{"unknown quota", 15, Quota{}, 4 * time.Second, 4 * time.Second},
+		{"expired quota", 15, Quota{Known: true, Remaining: 0, ResetAt: time.Now().Add(-time.Second)},
+			4 * time.Second, 4 * time.Second},
+		{"quota exhausted", 15, Quota{Known: true, Remaining: 0, ResetAt: time.Now().Add(time.Minute)},
+			59 * time.Second, time.Minute},
+		{"requests left", 15, Quota{Known: true, Remaining: 5, ResetAt: time.Now().Add(time.Minute)},
+			9 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider = &fakeProvider{rateLimit: tt.rateLimit, quota: tt.quota}
+			if delay := pacingDelay(); delay < tt.min || delay > tt.max {
+				t.Errorf("pacingDelay() = %s, want between %s and %s", delay, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestBudget(t *testing.T) {
+	defer func(p GeolocProvider) { provider = p }(provider)
+
+	tests := []struct {
+		name      string
+		rateLimit int
+		quota     Quota
+		want      int
+	}{
+		{"unlimited", 0, Quota{}, -1},
+		{"unknown quota", 15, Quota{}, 15},
+		{"expired quota", 15, Quota{Known: true, Remaining: 2, ResetAt: time.Now().Add(-time.Second)}, 15},
+		{"requests left", 15, Quota{Known: true, Remaining: 5, ResetAt: time.Now().Add(time.Minute)}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider = &fakeProvider{rateLimit: tt.rateLimit, quota: tt.quota}
+			if got := budget(); got != tt.want {
+				t.Errorf("budget() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributeBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		uncached []int
+		budget   int
+		first    int
+		want     []int
+	}{
+		{"unlimited", []int{25, 3}, -1, 0, []int{25, 3}},
+		{"no budget", []int{25, 3}, 0, 0, []int{0, 0}},
+		{"fair share", []int{25, 25}, 2, 0, []int{10, 10}},
+		{"first chain served first", []int{25, 25}, 3, 1, []int{10, 20}},
+		{"unused share goes to the others", []int{35, 3}, 4, 0, []int{30, 3}},
+		{"more budget than peers", []int{5, 0}, 10, 0, []int{5, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			works := make([]*chainWork, len(tt.uncached))
+			for i, count := range tt.uncached {
+				works[i] = &chainWork{}
+				for j := 0; j < count; j++ {
+					works[i].uncached = append(works[i].uncached, nil)
+				}
+			}
+			distributeBudget(works, tt.budget, 10, tt.first)
+			for i, work := range works {
+				if work.allotted != tt.want[i] {
+					t.Errorf("chain %d allotted %d, want %d", i, work.allotted, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSleepCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := sleep(ctx, time.Hour); err == nil {
+		t.Error("sleep() = nil, want the context error")
+	}
+	if time.Since(start) > time.Second {
+		t.Error("sleep() did not return when the context was cancelled")
+	}
+}
@@ -0,0 +1,193 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/libs/log"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"time"
+)
+
+const defaultInterval = 5 * time.Minute
+
+var (
+	logger    = log.MustNewDefaultLogger("text", "info", false)
+	db        *bolt.DB
+	interval  = defaultInterval
+	retention time.Duration
+)
+
+// SetLogger sets the logger reporting the history database errors
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
+// Sample is the state of a chain at a given time
+type Sample struct {
+	Time           time.Time      `json:"time"`
+	ConnectedPeers int            `json:"connected_peers"`
+	AddrBookSize   int            `json:"addrbook_size"`
+	ResolvedPeers  int            `json:"resolved_peers"`
+	LivePeers      int            `json:"live_peers"` // resolved peers which are not dead
+	Countries      map[string]int `json:"countries"`  // live peers per country
+	Asns           map[string]int `json:"asns"`       // live peers per AS
+	// peers per software, block and app version, among the peers which reported their NodeInfo recently
+	Versions *seednode.VersionCounts `json:"versions,omitempty"`
+}
+
+/*
+Init opens the history database in the multiseed home directory.
+Samples are stored in one bucket per chain, keyed by their big-endian unix timestamp so they are sorted by time
+*/
+func Init(cfg config.HistoryConfig) error {
+	dbPath := filepath.Join(config.HomeDir(), "history.db")
+
+	var err error
+	db, err = bolt.Open(dbPath, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to open history database %s: %w", dbPath, err)
+	}
+	if cfg.Interval > 0 {
+		interval = cfg.Interval
+	}
+	retention = cfg.Retention
+	return nil
+}
+
+// Interval returns the delay between two samples of every chain
+func Interval() time.Duration {
+	return interval
+}
+
+// Record samples the current state of a chain
+func Record(cfg seednode.SeedNodeConfig) {
+	if db == nil {
+		return
+	}
+	sample := Sample{
+		Time:           time.Now().UTC(),
+		ConnectedPeers: cfg.Sw.Peers().Size(),
+		AddrBookSize:   cfg.AddrBook.Size(),
+		Countries:      make(map[string]int),
+		Asns:           make(map[string]int),
+	}
+	if chain, ok := geoloc.ResolvedPeers.Chain(cfg.Cfg.ChainId); ok {
+		sample.ResolvedPeers = len(chain.Nodes)
+		for _, node := range chain.Nodes {
+			if node.Status == geoloc.PeerDead {
+				continue
+			}
+			sample.LivePeers++
+			sample.Countries[node.Country]++
+			sample.Asns[node.As]++
+		}
+	}
+	if cfg.NodeInfos != nil {
+		versions := seednode.CountVersions(cfg.NodeInfos.VersionGroups(sample.Time.Add(-seednode.VersionsWindow)))
+		sample.Versions = &versions
+	}
+
+	value, err := json.Marshal(sample)
+	if err != nil {
+		logger.Error("Failed to marshal history sample: " + err.Error())
+		return
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(cfg.Cfg.ChainId))
+		if err != nil {
+			return err
+		}
+		return bucket.Put(timeKey(sample.Time), value)
+	})
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to record history of chain %s: %s", cfg.Cfg.PrettyName, err.Error()))
+	}
+}
+
+// Range returns the samples of a chain between from and to. When resolution is set, only the last sample of
+// every resolution window is returned
+func Range(chainId string, from time.Time, to time.Time, resolution time.Duration) ([]Sample, error) {
+	samples := make([]Sample, 0)
+	if db == nil {
+		return samples, nil
+	}
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(chainId))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		toKey := timeKey(to)
+		for k, v := cursor.Seek(timeKey(from)); k != nil && string(k) <= string(toKey); k, v = cursor.Next() {
+			var sample Sample
+			if err := json.Unmarshal(v, &sample); err != nil {
+				return err
+			}
+			if resolution > 0 && len(samples) > 0 &&
+				samples[len(samples)-1].Time.Truncate(resolution).Equal(sample.Time.Truncate(resolution)) {
+				samples[len(samples)-1] = sample // same window, keep the last one
+				continue
+			}
+			samples = append(samples, sample)
+		}
+		return nil
+	})
+	return samples, err
+}
+
+func Close() {
+	if db != nil {
+		_ = db.Close()
+	}
+}
+
+/*
+Prune removes the samples older than the retention from every chain, and the buckets left empty, i.e. the ones of the
+chains removed from the config file since
+*/
+func Prune() {
+	if db == nil || retention <= 0 {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		beforeKey := timeKey(time.Now().UTC().Add(-retention))
+		var emptyBuckets [][]byte
+		err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			cursor := bucket.Cursor()
+			for k, _ := cursor.First(); k != nil && string(k) < string(beforeKey); k, _ = cursor.First() {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+			if k, _ := cursor.First(); k == nil {
+				emptyBuckets = append(emptyBuckets, append([]byte(nil), name...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range emptyBuckets {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to prune the history: " + err.Error())
+	}
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	if t.Unix() > 0 {
+		binary.BigEndian.PutUint64(key, uint64(t.Unix()))
+	}
+	return key
+}
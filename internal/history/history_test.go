@@ -0,0 +1,101 @@
+package history
+
+import (
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	bolt "go.etcd.io/bbolt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name      string
+		retention time.Duration
+		samples   map[string][]time.Time
+		want      map[string]int
+	}{
+		{
+			"old samples removed",
+			24 * time.Hour,
+			map[string][]time.Time{"cosmoshub-4": {now.Add(-48 * time.Hour), now.Add(-time.Hour), now}},
+			map[string]int{"cosmoshub-4": 2},
+		},
+		{
+			"removed chain dropped",
+			24 * time.Hour,
+			map[string][]time.Time{"cosmoshub-4": {now}, "osmosis-1": {now.Add(-48 * time.Hour)}},
+			map[string]int{"cosmoshub-4": 1},
+		},
+		{
+			"kept forever",
+			0,
+			map[string][]time.Time{"cosmoshub-4": {now.Add(-48 * time.Hour), now}},
+			map[string]int{"cosmoshub-4": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.SetHome(t.TempDir())
+			if err := Init(config.HistoryConfig{Retention: tt.retention}); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			defer Close()
+			err := db.Update(func(tx *bolt.Tx) error {
+				for chainId, times := range tt.samples {
+					bucket, err := tx.CreateBucket([]byte(chainId))
+					if err != nil {
+						return err
+					}
+					for _, sampleTime := range times {
+						if err := bucket.Put(timeKey(sampleTime), []byte("{}")); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			Prune()
+
+			got := make(map[string]int)
+			_ = db.View(func(tx *bolt.Tx) error {
+				return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+					got[string(name)] = bucket.Stats().KeyN
+					return nil
+				})
+			})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("samples after Prune() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+	}{
+		{"default", 0, defaultInterval},
+		{"configured", time.Minute, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval = defaultInterval
+			config.SetHome(t.TempDir())
+			if err := Init(config.HistoryConfig{Interval: tt.interval}); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+			defer Close()
+			if got := Interval(); got != tt.want {
+				t.Errorf("Interval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
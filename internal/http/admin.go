@@ -0,0 +1,194 @@
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	adminMtx   sync.RWMutex
+	adminToken string
+)
+
+// adminChain is a configured chain, as listed by the admin API
+type adminChain struct {
+	ChainId              string `json:"chain_id"`
+	PrettyName           string `json:"pretty_name"`
+	ListenAddress        string `json:"laddr"`
+	BootstrapPeers       string `json:"bootstrap_peers"`
+	NodeId               string `json:"node_id,omitempty"`
+	InboundPeers         int    `json:"inbound_peers"`
+	OutboundPeers        int    `json:"outbound_peers"`
+	AddrBookSize         int    `json:"addrbook_size"`
+	seednode.ChainStatus        // state, and the error of a failed chain
+}
+
+type bootstrapPeersRequest struct {
+	BootstrapPeers string `json:"bootstrap_peers"`
+}
+
+/*
+RegisterAdminApi exposes the endpoints used to manage the chains at runtime:
+
+	GET  /api/admin/chains                             list the configured chains
+	POST /api/admin/chains/<chain_id>/start            start a stopped chain
+	POST /api/admin/chains/<chain_id>/stop             stop a chain, until it is started again or the config file is reloaded
+	POST /api/admin/chains/<chain_id>/restart          restart a chain
+	PUT  /api/admin/chains/<chain_id>/bootstrap-peers  replace the bootstrap peers, i.e. {"bootstrap_peers": "id@host:port,..."}
+	POST /api/admin/chains/<chain_id>/save-addrbook    save the address book to disk
+	POST /api/admin/geoloc/resolve                     start a geolocation round now
+
+Every request must be authenticated with the token of the [admin] config section, the API is disabled without token
+*/
+func RegisterAdminApi(adminConfig config.AdminConfig, seedNodes *seednode.Manager, scheduler *geoloc.Scheduler) {
+	SetAdminToken(adminConfig.Token)
+
+	http.HandleFunc("/api/admin/chains", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminChains(w, seedNodes)
+	}))
+	http.HandleFunc("/api/admin/chains/", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		handleChainAction(w, r, seedNodes)
+	}))
+	http.HandleFunc("/api/admin/geoloc/resolve", requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		scheduler.Trigger()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+// SetAdminToken replaces the token of the admin API, an empty token disables it
+func SetAdminToken(token string) {
+	adminMtx.Lock()
+	defer adminMtx.Unlock()
+	adminToken = token
+}
+
+// requireAdmin checks the "Authorization: Bearer <token>" header of the request
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		adminMtx.RLock()
+		token := adminToken
+		adminMtx.RUnlock()
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, "Bearer ")), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeAdminChains(w http.ResponseWriter, seedNodes *seednode.Manager) {
+	chains := make([]adminChain, 0)
+	for _, cfg := range seedNodes.Configs() {
+		chain := adminChain{
+			ChainId:        cfg.ChainId,
+			PrettyName:     cfg.PrettyName,
+			ListenAddress:  cfg.P2P.ListenAddress,
+			BootstrapPeers: cfg.P2P.BootstrapPeers,
+		}
+		chain.ChainStatus, _ = seedNodes.Status(cfg.ChainId)
+		if seedNode, ok := seedNodes.Get(cfg.ChainId); ok {
+			chain.NodeId = string(seedNode.Sw.NodeInfo().NodeID)
+			chain.OutboundPeers, chain.InboundPeers, _ = seedNode.Sw.NumPeers()
+			chain.AddrBookSize = seedNode.AddrBook.Size()
+		}
+		chains = append(chains, chain)
+	}
+	writeJson(w, chains)
+}
+
+// handleChainAction dispatches /api/admin/chains/<chain_id>/<action>
+func handleChainAction(w http.ResponseWriter, r *http.Request, seedNodes *seednode.Manager) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/admin/chains/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	chainId, action := parts[0], parts[1]
+
+	method := http.MethodPost
+	if action == "bootstrap-peers" {
+		method = http.MethodPut
+	}
+	if r.Method != method {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch action {
+	case "start":
+		err = seedNodes.StartChain(chainId)
+	case "stop":
+		err = seedNodes.Stop(chainId)
+	case "restart":
+		err = seedNodes.Restart(chainId)
+	case "bootstrap-peers":
+		var request bootstrapPeersRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = seedNodes.UpdateBootstrapPeers(chainId, request.BootstrapPeers)
+	case "save-addrbook":
+		err = seedNodes.SaveAddrBook(chainId)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		logger.Error("Admin request failed: " + err.Error())
+		http.Error(w, err.Error(), adminErrorStatus(err))
+		return
+	}
+	logger.Info("Admin request: " + action + " " + chainId)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, seednode.ErrUnknownChain):
+		return http.StatusNotFound
+	case errors.Is(err, seednode.ErrChainRunning), errors.Is(err, seednode.ErrChainNotRunning):
+		return http.StatusConflict
+	case errors.Is(err, seednode.ErrInvalidPeers):
+		return http.StatusBadRequest
+	case errors.Is(err, seednode.ErrShuttingDown):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	marshal, err := json.Marshal(v)
+	if err != nil {
+		logger.Info("Failed to marshal response")
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(marshal)
+}
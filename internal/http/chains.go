@@ -0,0 +1,145 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// chainSummary is a configured chain and its counters, as listed by /api/chains
+type chainSummary struct {
+	ChainId       string                    `json:"chain_id"`
+	PrettyName    string                    `json:"pretty_name"`
+	State         seednode.ChainState       `json:"state"`
+	InboundPeers  int                       `json:"inbound_peers"`
+	OutboundPeers int                       `json:"outbound_peers"`
+	AddrBookSize  int                       `json:"addrbook_size"`
+	ResolvedPeers int                       `json:"resolved_peers"`
+	PeersByStatus map[geoloc.PeerStatus]int `json:"peers_by_status"`
+}
+
+const (
+	defaultBestPeers = 20
+	maxBestPeers     = 200
+)
+
+/*
+RegisterChainsApi exposes the public endpoints of the chains:
+
+	GET /api/chains                        the configured chains with their peers counts, sorted by chain id
+	GET /api/chains/<chain_id>/status      health of a chain: switch, listener, peers, address book, last PEX exchange and geolocation
+	GET /api/chains/<chain_id>/best-peers  best peers of the address book, i.e. ?limit=20&format=peers
+	GET /api/chains/<chain_id>/versions    share of the peers per software, block and app version, and their history
+*/
+func RegisterChainsApi(seedNodes *seednode.Manager) {
+	http.HandleFunc("/api/chains", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		writeCachedJson(w, r, chainSummaries(seedNodes))
+	})
+	http.HandleFunc("/api/chains/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/chains/"), "/")
+		if len(parts) != 2 || parts[0] == "" {
+			http.NotFound(w, r)
+			return
+		}
+		switch parts[1] {
+		case "status":
+			writeChainHealth(w, seedNodes, parts[0])
+		case "best-peers":
+			writeBestPeers(w, r, seedNodes, parts[0])
+		case "versions":
+			writeVersions(w, r, seedNodes, parts[0])
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func chainSummaries(seedNodes *seednode.Manager) []chainSummary {
+	chains := make([]chainSummary, 0)
+	for _, cfg := range seedNodes.Configs() {
+		chain := chainSummary{ChainId: cfg.ChainId, PrettyName: cfg.PrettyName}
+		status, _ := seedNodes.Status(cfg.ChainId)
+		chain.State = status.State
+		if seedNode, ok := seedNodes.Get(cfg.ChainId); ok {
+			chain.OutboundPeers, chain.InboundPeers, _ = seedNode.Sw.NumPeers()
+			chain.AddrBookSize = seedNode.AddrBook.Size()
+		}
+		chain.PeersByStatus = countByStatus(cfg.ChainId)
+		for _, count := range chain.PeersByStatus {
+			chain.ResolvedPeers += count
+		}
+		chains = append(chains, chain)
+	}
+	return chains
+}
+
+// countByStatus counts the geolocalized peers of a chain by liveness status
+func countByStatus(chainId string) map[geoloc.PeerStatus]int {
+	byStatus := map[geoloc.PeerStatus]int{geoloc.PeerOnline: 0, geoloc.PeerStale: 0, geoloc.PeerDead: 0}
+	if chain, ok := geoloc.ResolvedPeers.Chain(chainId); ok {
+		for _, node := range chain.Nodes {
+			if _, ok := byStatus[node.Status]; ok {
+				byStatus[node.Status]++
+			}
+		}
+	}
+	return byStatus
+}
+
+/*
+writeBestPeers returns the best peers of a chain, recently connected, reachable and spread over ASNs and countries.
+format is json (default), peers for a nodeid@ip:port list to paste in persistent_peers or seeds, or addrbook for the
+addrbook.json of a tendermint node. The address book of a stopped chain is read from disk
+*/
+func writeBestPeers(w http.ResponseWriter, r *http.Request, seedNodes *seednode.Manager, chainId string) {
+	limit := defaultBestPeers
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = parseCount(value); err != nil || limit == 0 || limit > maxBestPeers {
+			http.Error(w, fmt.Sprintf("invalid limit parameter, expected 1 to %d", maxBestPeers), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var addresses []*pex.KnownAddress
+	var probes map[types.NodeID]seednode.ProbeResult
+	if seedNode, ok := seedNodes.Get(chainId); ok {
+		addresses = seedNode.AddrBook.GetAddrbookContent()
+		probes = seedNode.Prober.Results()
+	} else if _, ok := seedNodes.Status(chainId); ok {
+		var err error
+		if addresses, err = seednode.ReadAddrBookFile(chainId); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("Failed to read address book: " + err.Error())
+			http.Error(w, "failed to read the address book", http.StatusInternalServerError)
+			return
+		}
+		if probes, err = seednode.ReadProbes(chainId); err != nil {
+			logger.Error("Failed to read the probes, ranking without them: " + err.Error())
+		}
+	} else {
+		http.Error(w, "unknown chain: "+chainId, http.StatusNotFound)
+		return
+	}
+	best := seednode.BestPeers(addresses, probes, limit)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeCachedJson(w, r, seednode.ExportPeers(best))
+	case "peers":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte(seednode.PeersString(best) + "\n"))
+	case "addrbook":
+		w.Header().Set("Content-Disposition", `attachment; filename="addrbook.json"`)
+		writeJson(w, seednode.NewTendermintAddrBook(best))
+	default:
+		http.Error(w, "unknown format "+format, http.StatusBadRequest)
+	}
+}
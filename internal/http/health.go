@@ -0,0 +1,96 @@
+package http
+
+import (
+	"errors"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	healthMtx      sync.RWMutex
+	noPeersTimeout time.Duration
+)
+
+type readiness struct {
+	Ready  bool                   `json:"ready"`
+	Chains []seednode.ChainHealth `json:"chains"`
+}
+
+/*
+RegisterHealthApi exposes the health checks, which answer 503 when something is wrong:
+
+	GET /healthz  the process is alive, always 200
+	GET /readyz   no running chain has been without peers for longer than no_peers_timeout, and one chain at least
+	              is healthy
+
+A chain which failed to start doesn't make the process unready, the others keep serving. The health of a single chain,
+failures included, is served on /api/chains/<chain_id>/status, see RegisterChainsApi
+*/
+func RegisterHealthApi(healthConfig config.HealthConfig, seedNodes *seednode.Manager) {
+	SetNoPeersTimeout(healthConfig.NoPeersTimeout)
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		writeReadiness(w, seedNodes)
+	})
+}
+
+// SetNoPeersTimeout replaces the delay after which a chain without peers is unhealthy, 0 disables the check
+func SetNoPeersTimeout(timeout time.Duration) {
+	healthMtx.Lock()
+	defer healthMtx.Unlock()
+	noPeersTimeout = timeout
+}
+
+func getNoPeersTimeout() time.Duration {
+	healthMtx.RLock()
+	defer healthMtx.RUnlock()
+	return noPeersTimeout
+}
+
+func writeReadiness(w http.ResponseWriter, seedNodes *seednode.Manager) {
+	response := readiness{Chains: make([]seednode.ChainHealth, 0)}
+	for _, cfg := range seedNodes.Configs() {
+		health, err := seedNodes.Health(cfg.ChainId, getNoPeersTimeout())
+		if err != nil {
+			continue // removed in the meantime
+		}
+		response.Chains = append(response.Chains, health)
+	}
+	response.Ready = isReady(response.Chains)
+	if !response.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJson(w, response)
+}
+
+// isReady tells whether one chain at least is healthy, and no running chain has been without peers for too long
+func isReady(chains []seednode.ChainHealth) bool {
+	healthy := false
+	for _, health := range chains {
+		if health.NoPeers {
+			return false
+		}
+		healthy = healthy || health.Healthy
+	}
+	return healthy
+}
+
+func writeChainHealth(w http.ResponseWriter, seedNodes *seednode.Manager, chainId string) {
+	health, err := seedNodes.Health(chainId, getNoPeersTimeout())
+	if errors.Is(err, seednode.ErrUnknownChain) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !health.Healthy {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJson(w, health)
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"testing"
+)
+
+func TestIsReady(t *testing.T) {
+	healthy := seednode.ChainHealth{Healthy: true, ChainStatus: seednode.ChainStatus{State: seednode.ChainRunning}}
+	failed := seednode.ChainHealth{Reason: "chain is failed", ChainStatus: seednode.ChainStatus{State: seednode.ChainFailed}}
+	stopped := seednode.ChainHealth{Reason: "chain is stopped", ChainStatus: seednode.ChainStatus{State: seednode.ChainStopped}}
+	noPeers := seednode.ChainHealth{Reason: "no peers for 20m0s", NoPeers: true,
+		ChainStatus: seednode.ChainStatus{State: seednode.ChainRunning}}
+
+	tests := []struct {
+		name   string
+		chains []seednode.ChainHealth
+		want   bool
+	}{
+		{"all healthy", []seednode.ChainHealth{healthy, healthy}, true},
+		{"one chain failed", []seednode.ChainHealth{healthy, failed}, true},
+		{"one chain stopped", []seednode.ChainHealth{stopped, healthy}, true},
+		{"one chain without peers", []seednode.ChainHealth{healthy, noPeers}, false},
+		{"no healthy chain", []seednode.ChainHealth{failed, stopped}, false},
+		{"no chains", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isReady(tt.chains); got != tt.want {
+				t.Errorf("isReady() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	peersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(seednode.MetricsNamespace, "p2p", "peers"),
+		"Number of peers connected to the seed node.",
+		append(seednode.ChainLabels, "direction"), nil)
+	addrBookSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(seednode.MetricsNamespace, "addrbook", "size"),
+		"Number of addresses in the address book.",
+		append(seednode.ChainLabels, "bucket"), nil)
+	resolvedPeersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(seednode.MetricsNamespace, "geoloc", "resolved_peers"),
+		"Number of geolocalized peers.",
+		append(seednode.ChainLabels, "status"), nil)
+	peersByVersionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(seednode.MetricsNamespace, "p2p", "peers_by_version"),
+		"Number of peers which reported their NodeInfo during the last 24 hours, by software (semantic versions only, other otherwise), block and app version.",
+		append(seednode.ChainLabels, "version", "block_version", "app_version"), nil)
+)
+
+const maxVersionLabelLength = 32
+
+// the version reported by a peer is exported as a label only if it is a semantic version, i.e. v0.34.21 or 0.37.0-rc1
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// versionLabel returns the version reported by a peer if it is a short semantic version, or "other". Peers report any
+// string, exporting them as is would let them create an unbounded number of series
+func versionLabel(version string) string {
+	if len(version) > maxVersionLabelLength || !semverRegexp.MatchString(version) {
+		return "other"
+	}
+	return version
+}
+
+// chainsCollector reads the state of every seed node when the metrics are scraped
+type chainsCollector struct {
+	seedNodes func() []seednode.SeedNodeConfig
+}
+
+// RegisterMetrics exposes the metrics of the running seed nodes on /metrics
+func RegisterMetrics(seedNodes func() []seednode.SeedNodeConfig) {
+	prometheus.MustRegister(&chainsCollector{seedNodes})
+}
+
+func (c *chainsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- peersDesc
+	ch <- addrBookSizeDesc
+	ch <- resolvedPeersDesc
+	ch <- peersByVersionDesc
+}
+
+func (c *chainsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, seedNode := range c.seedNodes() {
+		chainId, prettyName := seedNode.Cfg.ChainId, seedNode.Cfg.PrettyName
+
+		outbound, inbound, _ := seedNode.Sw.NumPeers()
+		ch <- prometheus.MustNewConstMetric(peersDesc, prometheus.GaugeValue, float64(inbound), chainId, prettyName, "inbound")
+		ch <- prometheus.MustNewConstMetric(peersDesc, prometheus.GaugeValue, float64(outbound), chainId, prettyName, "outbound")
+
+		newBucket, oldBucket := seednode.AddrBookSize(seedNode.AddrBook)
+		ch <- prometheus.MustNewConstMetric(addrBookSizeDesc, prometheus.GaugeValue, float64(newBucket), chainId, prettyName, "new")
+		ch <- prometheus.MustNewConstMetric(addrBookSizeDesc, prometheus.GaugeValue, float64(oldBucket), chainId, prettyName, "old")
+
+		for status, count := range countByStatus(chainId) {
+			ch <- prometheus.MustNewConstMetric(resolvedPeersDesc, prometheus.GaugeValue, float64(count), chainId, prettyName, string(status))
+		}
+
+		// versions which are not exported as is are merged into "other"
+		byLabels := make(map[[3]string]int)
+		for _, group := range seedNode.NodeInfos.VersionGroups(time.Now().Add(-seednode.VersionsWindow)) {
+			labels := [3]string{versionLabel(group.Version), strconv.FormatUint(group.BlockVersion, 10),
+				strconv.FormatUint(group.AppVersion, 10)}
+			byLabels[labels] += group.Peers
+		}
+		for labels, peers := range byLabels {
+			ch <- prometheus.MustNewConstMetric(peersByVersionDesc, prometheus.GaugeValue, float64(peers), chainId, prettyName,
+				labels[0], labels[1], labels[2])
+		}
+	}
+}
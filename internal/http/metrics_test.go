@@ -0,0 +1,29 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionLabel(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"v0.34.21", "v0.34.21"},
+		{"0.37.0", "0.37.0"},
+		{"v0.38.0-rc1", "v0.38.0-rc1"},
+		{"v0.34.21+build.5", "v0.34.21+build.5"},
+		{"", "other"},
+		{"1.0", "other"},
+		{"v01.2.3", "other"},
+		{"my custom node", "other"},
+		{"v0.34.21\n", "other"},
+		{"v1.2.3-" + strings.Repeat("a", 40), "other"},
+	}
+	for _, tt := range tests {
+		if got := versionLabel(tt.version); got != tt.want {
+			t.Errorf("versionLabel(%q) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
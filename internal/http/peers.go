@@ -0,0 +1,200 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// peersChain is a chain and the page of its peers matching the query
+type peersChain struct {
+	ChainId    string      `json:"chain_id"`
+	PrettyName string      `json:"pretty_name"`
+	Total      int         `json:"total"` // number of peers matching the filters, before limit and offset
+	Nodes      interface{} `json:"nodes"` // []geoloc.GeolocalizedPeers, or only the requested fields
+}
+
+// peersQuery holds the parameters of /api/peers. Empty filters match every peer
+type peersQuery struct {
+	chains    []string
+	statuses  map[geoloc.PeerStatus]bool
+	reachable map[geoloc.Reachability]bool
+	countries map[string]bool // lower case
+	asns      map[string]bool // AS numbers, without the AS prefix
+	versions  map[string]bool
+	since     time.Time
+	limit     int // 0 for no limit
+	offset    int
+	fields    []string
+}
+
+// json names of the peer fields, accepted by the fields parameter
+var peerFields = jsonFields(reflect.TypeOf(geoloc.GeolocalizedPeers{}))
+
+func parsePeersQuery(values url.Values) (peersQuery, error) {
+	var query peersQuery
+	var err error
+	query.chains = splitList(values.Get("chain"))
+	query.statuses = make(map[geoloc.PeerStatus]bool)
+	for _, status := range splitList(values.Get("status")) {
+		query.statuses[geoloc.PeerStatus(status)] = true
+	}
+	query.reachable = make(map[geoloc.Reachability]bool)
+	for _, reachability := range splitList(values.Get("reachability")) {
+		query.reachable[geoloc.Reachability(reachability)] = true
+	}
+	query.countries = make(map[string]bool)
+	for _, country := range splitList(values.Get("country")) {
+		query.countries[strings.ToLower(country)] = true
+	}
+	query.asns = make(map[string]bool)
+	for _, asn := range splitList(values.Get("asn")) {
+		query.asns[asNumber(asn)] = true
+	}
+	query.versions = make(map[string]bool)
+	for _, version := range splitList(values.Get("version")) {
+		query.versions[version] = true
+	}
+
+	if since := values.Get("since"); since != "" {
+		// an RFC3339 date, or a duration before now
+		if query.since, err = time.Parse(time.RFC3339, since); err != nil {
+			duration, durationErr := time.ParseDuration(since)
+			if durationErr != nil || duration < 0 {
+				return query, fmt.Errorf("invalid since parameter, expected an RFC3339 date or a duration")
+			}
+			query.since = time.Now().Add(-duration)
+		}
+	}
+	if query.limit, err = parseCount(values.Get("limit")); err != nil {
+		return query, fmt.Errorf("invalid limit parameter")
+	}
+	if query.offset, err = parseCount(values.Get("offset")); err != nil {
+		return query, fmt.Errorf("invalid offset parameter")
+	}
+	query.fields = splitList(values.Get("fields"))
+	for _, field := range query.fields {
+		if !peerFields[field] {
+			return query, fmt.Errorf("unknown field %s", field)
+		}
+	}
+	return query, nil
+}
+
+func (q *peersQuery) match(peer geoloc.GeolocalizedPeers) bool {
+	if len(q.statuses) > 0 && !q.statuses[peer.Status] {
+		return false
+	}
+	if len(q.reachable) > 0 && !q.reachable[peer.Reachability] {
+		return false
+	}
+	if len(q.countries) > 0 && !q.countries[strings.ToLower(peer.Country)] {
+		return false
+	}
+	if len(q.asns) > 0 && !q.asns[asNumber(peer.As)] {
+		return false
+	}
+	if len(q.versions) > 0 && !q.versions[peer.Version] {
+		return false
+	}
+	return q.since.IsZero() || !peer.LastSeen.Before(q.since)
+}
+
+// apply filters and paginates the peers of a chain
+func (q *peersQuery) apply(chain geoloc.Chain) (peersChain, error) {
+	nodes := make([]geoloc.GeolocalizedPeers, 0, len(chain.Nodes))
+	for _, node := range chain.Nodes {
+		if q.match(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	result := peersChain{ChainId: chain.ChainId, PrettyName: chain.PrettyName, Total: len(nodes)}
+
+	if q.offset < len(nodes) {
+		nodes = nodes[q.offset:]
+	} else {
+		nodes = nodes[:0]
+	}
+	if q.limit > 0 && q.limit < len(nodes) {
+		nodes = nodes[:q.limit]
+	}
+	if len(q.fields) == 0 {
+		result.Nodes = nodes
+		return result, nil
+	}
+	selected, err := selectFields(nodes, q.fields)
+	result.Nodes = selected
+	return result, err
+}
+
+// selectFields keeps only the given json fields of the peers
+func selectFields(nodes []geoloc.GeolocalizedPeers, fields []string) ([]map[string]json.RawMessage, error) {
+	selected := make([]map[string]json.RawMessage, 0, len(nodes))
+	for _, node := range nodes {
+		marshal, err := json.Marshal(node)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(marshal, &all); err != nil {
+			return nil, err
+		}
+		values := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			values[field] = all[field]
+		}
+		selected = append(selected, values)
+	}
+	return selected, nil
+}
+
+// asNumber returns the number of an AS, i.e. 16509 for "AS16509 Amazon.com, Inc." or "as16509"
+func asNumber(as string) string {
+	fields := strings.Fields(as)
+	if len(fields) == 0 {
+		return ""
+	}
+	number := fields[0]
+	if len(number) > 2 && strings.EqualFold(number[:2], "AS") {
+		number = number[2:]
+	}
+	return number
+}
+
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// splitList splits a comma separated parameter, ignoring the empty values
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseCount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid count %s", value)
+	}
+	return count, nil
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"encoding/json"
+	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePeers(t *testing.T) {
+	now := time.Now()
+	geoloc.ResolvedPeers.InitChain("test-1", "Test", []geoloc.GeolocalizedPeers{
+		{NodeId: "a", Status: geoloc.PeerOnline, Reachability: geoloc.Reachable, Country: "Germany",
+			As: "AS24940 Hetzner Online GmbH", Version: "v0.34.21", LastSeen: now.Add(-time.Minute)},
+		{NodeId: "b", Status: geoloc.PeerStale, Reachability: geoloc.Unreachable, Country: "United States",
+			As: "AS16509 Amazon.com, Inc.", Version: "v0.34.21", LastSeen: now.Add(-2 * time.Hour)},
+		{NodeId: "c", Status: geoloc.PeerDead, Reachability: geoloc.ReachabilityUnknown, Country: "germany",
+			As: "AS16509 Amazon.com, Inc.", Version: "v0.34.19", LastSeen: now.Add(-48 * time.Hour)},
+	})
+	geoloc.ResolvedPeers.InitChain("test-2", "Other", nil)
+	defer geoloc.ResolvedPeers.RemoveChain("test-1")
+	defer geoloc.ResolvedPeers.RemoveChain("test-2")
+
+	tests := []struct {
+		name      string
+		query     string
+		status    int
+		wantTotal int
+		wantNodes []string
+	}{
+		{"all", "chain=test-1", http.StatusOK, 3, []string{"a", "b", "c"}},
+		{"status", "chain=test-1&status=online,stale", http.StatusOK, 2, []string{"a", "b"}},
+		{"reachability", "chain=test-1&reachability=reachable", http.StatusOK, 1, []string{"a"}},
+		{"country, any case", "chain=test-1&country=GERMANY", http.StatusOK, 2, []string{"a", "c"}},
+		{"asn", "chain=test-1&asn=as16509", http.StatusOK, 2, []string{"b", "c"}},
+		{"version", "chain=test-1&version=v0.34.19", http.StatusOK, 1, []string{"c"}},
+		{"filters combined", "chain=test-1&asn=16509&country=germany", http.StatusOK, 1, []string{"c"}},
+		{"since duration", "chain=test-1&since=3h", http.StatusOK, 2, []string{"a", "b"}},
+		{"since date", "chain=test-1&since=" + now.Add(-time.Hour).UTC().Format(time.RFC3339), http.StatusOK, 1, []string{"a"}},
+		{"invalid since", "chain=test-1&since=yesterday", http.StatusBadRequest, 0, nil},
+		{"negative since", "chain=test-1&since=-1h", http.StatusBadRequest, 0, nil},
+		{"limit", "chain=test-1&limit=2", http.StatusOK, 3, []string{"a", "b"}},
+		{"offset", "chain=test-1&offset=1", http.StatusOK, 3, []string{"b", "c"}},
+		{"offset and limit", "chain=test-1&offset=1&limit=1", http.StatusOK, 3, []string{"b"}},
+		{"limit above the total", "chain=test-1&limit=10", http.StatusOK, 3, []string{"a", "b", "c"}},
+		{"offset at the total", "chain=test-1&offset=3", http.StatusOK, 3, []string{}},
+		{"offset above the total", "chain=test-1&offset=10&limit=1", http.StatusOK, 3, []string{}},
+		{"no limit", "chain=test-1&limit=0", http.StatusOK, 3, []string{"a", "b", "c"}},
+		{"negative limit", "chain=test-1&limit=-1", http.StatusBadRequest, 0, nil},
+		{"negative offset", "chain=test-1&offset=-1", http.StatusBadRequest, 0, nil},
+		{"invalid limit", "chain=test-1&limit=ten", http.StatusBadRequest, 0, nil},
+		{"unknown field", "chain=test-1&fields=node_id,ip", http.StatusBadRequest, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writePeers(recorder, httptest.NewRequest(http.MethodGet, "/api/peers?"+tt.query, nil))
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var response map[string]struct {
+				Total int                        `json:"total"`
+				Nodes []geoloc.GeolocalizedPeers `json:"nodes"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response) != 1 {
+				t.Errorf("response has %d chains, want the requested one", len(response))
+			}
+			chain := response["test-1"]
+			nodes := make([]string, 0, len(chain.Nodes))
+			for _, node := range chain.Nodes {
+				nodes = append(nodes, string(node.NodeId))
+			}
+			if chain.Total != tt.wantTotal || !reflect.DeepEqual(nodes, tt.wantNodes) {
+				t.Errorf("total, nodes = %d, %v, want %d, %v", chain.Total, nodes, tt.wantTotal, tt.wantNodes)
+			}
+		})
+	}
+}
+
+func TestWritePeersFields(t *testing.T) {
+	geoloc.ResolvedPeers.InitChain("test-1", "Test", []geoloc.GeolocalizedPeers{
+		{NodeId: "a", Country: "Germany", Lat: 50.1, Lon: 8.6},
+	})
+	defer geoloc.ResolvedPeers.RemoveChain("test-1")
+
+	recorder := httptest.NewRecorder()
+	writePeers(recorder, httptest.NewRequest(http.MethodGet, "/api/peers?chain=test-1&fields=node_id,+lat,lon,", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body)
+	}
+	var response map[string]struct {
+		Nodes []map[string]interface{} `json:"nodes"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	nodes := response["test-1"].Nodes
+	if len(nodes) != 1 {
+		t.Fatalf("%d nodes, want 1", len(nodes))
+	}
+	fields := make([]string, 0, len(nodes[0]))
+	for field := range nodes[0] {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	if strings.Join(fields, ",") != "lat,lon,node_id" {
+		t.Errorf("fields = %v, want lat, lon and node_id", fields)
+	}
+	if nodes[0]["node_id"] != "a" {
+		t.Errorf("node_id = %v, want a", nodes[0]["node_id"])
+	}
+}
@@ -0,0 +1,77 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// responses smaller than this are not worth compressing
+const gzipMinSize = 1024
+
+/*
+writeCachedJson writes v as JSON with an ETag, answering 304 Not Modified when the client already has it
+(If-None-Match), and compresses the body when the client accepts gzip
+*/
+func writeCachedJson(w http.ResponseWriter, r *http.Request, v interface{}) {
+	marshal, err := json.Marshal(v)
+	if err != nil {
+		logger.Info("Failed to marshal response")
+		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+	hash := fnv.New64a()
+	_, _ = hash.Write(marshal)
+	// weak, as the same ETag is sent for the gzipped and the plain body
+	etag := fmt.Sprintf(`W/"%x"`, hash.Sum64())
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Vary", "Accept-Encoding")
+	header.Set("Cache-Control", "no-cache") // revalidate with the ETag
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+
+	if len(marshal) < gzipMinSize || !acceptsGzip(r) {
+		_, _ = w.Write(marshal)
+		return
+	}
+	header.Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	_, _ = gz.Write(marshal)
+	_ = gz.Close()
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(encoding, ";")
+		if strings.TrimSpace(params[0]) != "gzip" {
+			continue
+		}
+		for _, param := range params[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				weight, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				return err == nil && weight > 0
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteCachedJson(t *testing.T) {
+	body := map[string]string{"chain_id": "cosmoshub-4"}
+	first := httptest.NewRecorder()
+	writeCachedJson(first, httptest.NewRequest(http.MethodGet, "/api/peers", nil), body)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status, ETag = %d, %q, want 200 and an ETag", first.Code, etag)
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"no If-None-Match", "", http.StatusOK},
+		{"same ETag", etag, http.StatusNotModified},
+		{"strong form of the ETag", strings.TrimPrefix(etag, "W/"), http.StatusNotModified},
+		{"one of the ETags", `W/"0", ` + etag, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"other ETag", `W/"0"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/peers", nil)
+			if tt.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+			writeCachedJson(recorder, request, body)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.want)
+			}
+			if recorder.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", recorder.Header().Get("ETag"), etag)
+			}
+			if tt.want == http.StatusNotModified && recorder.Body.Len() > 0 {
+				t.Errorf("304 has a body: %s", recorder.Body)
+			}
+			if tt.want == http.StatusOK && recorder.Body.String() != first.Body.String() {
+				t.Errorf("body = %s, want %s", recorder.Body, first.Body)
+			}
+		})
+	}
+}
+
+func TestWriteCachedJsonGzip(t *testing.T) {
+	large := strings.Repeat("a", gzipMinSize)
+	tests := []struct {
+		name           string
+		body           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"large body", large, "gzip, deflate", true},
+		{"small body", "a", "gzip", false},
+		{"gzip not accepted", large, "deflate", false},
+		{"gzip refused", large, "gzip;q=0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/peers", nil)
+			request.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			recorder := httptest.NewRecorder()
+			writeCachedJson(recorder, request, tt.body)
+
+			var reader io.Reader = recorder.Body
+			if gzipped := recorder.Header().Get("Content-Encoding") == "gzip"; gzipped != tt.wantGzip {
+				t.Fatalf("gzipped = %v, want %v", gzipped, tt.wantGzip)
+			} else if gzipped {
+				gz, err := gzip.NewReader(recorder.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = gz
+			}
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != `"`+tt.body+`"` {
+				t.Errorf("body = %.20s..., want the JSON string", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package http
+
+import (
+	"errors"
+	"github.com/highstakesswitzerland/multiseed/internal/history"
+	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// versionShare is the number and share of peers running a version
+type versionShare struct {
+	Version string  `json:"version"`
+	Peers   int     `json:"peers"`
+	Share   float64 `json:"share"` // between 0 and 1
+}
+
+// versionsSample is the versions distribution of a history sample
+type versionsSample struct {
+	Time     time.Time               `json:"time"`
+	Versions *seednode.VersionCounts `json:"versions"`
+}
+
+type versionsResponse struct {
+	ChainId       string                  `json:"chain_id"`
+	PrettyName    string                  `json:"pretty_name"`
+	Window        string                  `json:"window"` // peers which reported their NodeInfo within this window
+	Peers         int                     `json:"peers"`
+	Versions      []versionShare          `json:"versions"`
+	BlockVersions []versionShare          `json:"block_versions"`
+	AppVersions   []versionShare          `json:"app_versions"`
+	Breakdown     []seednode.VersionGroup `json:"breakdown"`
+	History       []versionsSample        `json:"history"`
+}
+
+/*
+writeVersions returns the share of the peers of a chain running every software, block and app version, and their
+history, i.e. /api/chains/cosmoshub-4/versions?from=2022-07-01T00:00:00Z&resolution=24h. The history takes the same
+parameters as /api/history. The node infos of a stopped chain are read from disk
+*/
+func writeVersions(w http.ResponseWriter, r *http.Request, seedNodes *seednode.Manager, chainId string) {
+	from, to, resolution, err := parseTimeRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var nodeInfos *seednode.NodeInfos
+	if seedNode, ok := seedNodes.Get(chainId); ok {
+		nodeInfos = seedNode.NodeInfos
+	} else if _, ok := seedNodes.Status(chainId); ok {
+		if nodeInfos, err = seednode.ReadNodeInfos(chainId); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Error("Failed to read node infos: " + err.Error())
+			http.Error(w, "failed to read the node infos", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		http.Error(w, "unknown chain: "+chainId, http.StatusNotFound)
+		return
+	}
+
+	groups := nodeInfos.VersionGroups(time.Now().Add(-seednode.VersionsWindow))
+	counts := seednode.CountVersions(groups)
+	response := versionsResponse{
+		ChainId:       chainId,
+		PrettyName:    prettyName(seedNodes, chainId),
+		Window:        seednode.VersionsWindow.String(),
+		Peers:         counts.Peers,
+		Versions:      versionShares(counts.Versions, counts.Peers),
+		BlockVersions: versionShares(uintKeys(counts.BlockVersions), counts.Peers),
+		AppVersions:   versionShares(uintKeys(counts.AppVersions), counts.Peers),
+		Breakdown:     groups,
+		History:       make([]versionsSample, 0),
+	}
+
+	samples, err := history.Range(chainId, from, to, resolution)
+	if err != nil {
+		logger.Error("Failed to read history: " + err.Error())
+		http.Error(w, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+	for _, sample := range samples {
+		if sample.Versions != nil { // recorded before the versions were
+			response.History = append(response.History, versionsSample{sample.Time, sample.Versions})
+		}
+	}
+	writeCachedJson(w, r, response)
+}
+
+// versionShares sorts the versions by number of peers, most common first
+func versionShares(counts map[string]int, total int) []versionShare {
+	shares := make([]versionShare, 0, len(counts))
+	for version, peers := range counts {
+		shares = append(shares, versionShare{Version: version, Peers: peers, Share: float64(peers) / float64(total)})
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Peers != shares[j].Peers {
+			return shares[i].Peers > shares[j].Peers
+		}
+		return shares[i].Version < shares[j].Version
+	})
+	return shares
+}
+
+func uintKeys(counts map[uint64]int) map[string]int {
+	result := make(map[string]int, len(counts))
+	for version, peers := range counts {
+		result[strconv.FormatUint(version, 10)] = peers
+	}
+	return result
+}
+
+func prettyName(seedNodes *seednode.Manager, chainId string) string {
+	for _, cfg := range seedNodes.Configs() {
+		if cfg.ChainId == chainId {
+			return cfg.PrettyName
+		}
+	}
+	return ""
+}
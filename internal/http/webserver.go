@@ -3,44 +3,151 @@ package http
 import (
 	"embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/HighStakesSwitzerland/tendermint/libs/log"
 	"github.com/highstakesswitzerland/multiseed/internal/config"
 	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"github.com/highstakesswitzerland/multiseed/internal/history"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 var (
 	logger = log.MustNewDefaultLogger("text", "info", false)
 )
 
+// SetLogger sets the logger of the web server and the admin API
+func SetLogger(l log.Logger) {
+	logger = l
+}
+
 type WebResources struct {
 	Res   embed.FS
 	Files map[string]string
 }
 
-func StartWebServer(seedConfig *config.TSConfig) {
+/*
+StartWebServer serves the API in the background. onError is called if the server stops unexpectedly,
+i.e. when the port is already in use. The returned server is shut down by the lifecycle
+*/
+func StartWebServer(seedConfig *config.TSConfig, onError func(error)) *http.Server {
 	// serve endpoint
 	http.HandleFunc("/api/peers", writePeers)
+	http.HandleFunc("/api/history", writeHistory)
+	http.Handle("/metrics", promhttp.Handler())
 
+	server := &http.Server{Addr: ":" + seedConfig.HttpPort}
 	// start web server in non-blocking
 	go func() {
-		err := http.ListenAndServe(":"+seedConfig.HttpPort, nil)
 		logger.Info("HTTP Server started", "port", seedConfig.HttpPort)
-		if err != nil {
-			panic(err)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			onError(fmt.Errorf("web server failed: %w", err))
 		}
 	}()
+	return server
 }
 
+/*
+writePeers returns the geolocalized peers of the chains, keyed by chain id. The peers can be filtered, paginated and
+reduced to some fields, i.e. /api/peers?chain=cosmoshub-4&status=online,stale&country=Germany&asn=AS16509&since=24h&limit=100&offset=200&fields=node_id,lat,lon
+chain, status, country, asn and fields are comma separated lists, since is an RFC3339 date or a duration before now.
+limit and offset apply to the peers of every chain, whose total is the number of peers matching the filters
+*/
 func writePeers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	marshal, err := json.Marshal(&geoloc.ResolvedPeers)
+	query, err := parsePeersQuery(r.URL.Query())
 	if err != nil {
-		logger.Info("Failed to marshal peers list")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var chains map[string]geoloc.Chain
+	if len(query.chains) > 0 {
+		chains = make(map[string]geoloc.Chain, len(query.chains))
+		for _, chainId := range query.chains {
+			if chain, ok := geoloc.ResolvedPeers.Chain(chainId); ok {
+				chains[chainId] = chain
+			}
+		}
+	} else {
+		chains = geoloc.ResolvedPeers.Snapshot()
+	}
+
+	response := make(map[string]peersChain, len(chains))
+	for chainId, chain := range chains {
+		if response[chainId], err = query.apply(chain); err != nil {
+			logger.Info("Failed to select the peers fields: " + err.Error())
+			http.Error(w, "failed to select the peers fields", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeCachedJson(w, r, response)
+}
+
+type historyResponse struct {
+	ChainId    string           `json:"chain_id"`
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Resolution string           `json:"resolution"`
+	Samples    []history.Sample `json:"samples"`
+}
+
+// writeHistory returns the peers count history of a chain, i.e. /api/history?chain=cosmoshub-4&from=2022-07-01T00:00:00Z&resolution=24h
+// from and to are RFC3339 dates and default to the last 30 days. The resolution is a duration, samples are not aggregated when unset
+func writeHistory(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	query := r.URL.Query()
+	response := historyResponse{
+		ChainId:    query.Get("chain"),
+		Resolution: query.Get("resolution"),
+	}
+	if response.ChainId == "" {
+		http.Error(w, "missing chain parameter", http.StatusBadRequest)
 		return
 	}
-	_, err = w.Write(marshal)
+	from, to, resolution, err := parseTimeRange(query)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	response.From, response.To = from, to
+
+	response.Samples, err = history.Range(response.ChainId, response.From, response.To, resolution)
+	if err != nil {
+		logger.Error("Failed to read history: " + err.Error())
+		http.Error(w, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+	marshal, err := json.Marshal(response)
+	if err != nil {
+		logger.Info("Failed to marshal history")
+		return
+	}
+	_, _ = w.Write(marshal)
+}
+
+// parseTimeRange reads the from, to and resolution parameters of the history endpoints.
+// from and to default to the last 30 days, the resolution to 0 (not aggregated)
+func parseTimeRange(query url.Values) (from time.Time, to time.Time, resolution time.Duration, err error) {
+	to = time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, resolution, fmt.Errorf("invalid to parameter: %w", err)
+		}
+	}
+	from = to.Add(-30 * 24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return from, to, resolution, fmt.Errorf("invalid from parameter: %w", err)
+		}
+	}
+	if value := query.Get("resolution"); value != "" {
+		if resolution, err = time.ParseDuration(value); err != nil || resolution < 0 {
+			return from, to, resolution, fmt.Errorf("invalid resolution parameter")
+		}
+	}
+	return from, to, resolution, nil
 }
@@ -0,0 +1,154 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/libs/log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// exit codes of the process
+const (
+	ExitOk             = 0
+	ExitFatal          = 1 // a component failed, i.e. the web server could not listen
+	ExitShutdownFailed = 2 // a stop hook failed or did not finish before the timeout
+	ExitForced         = 130
+)
+
+const DefaultShutdownTimeout = 30 * time.Second
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+/*
+Lifecycle coordinates the shutdown of the process. The components register a stop hook when they start,
+and the hooks are run one after another, in registration order, when SIGINT or SIGTERM is received or when
+a component reports a fatal error. Every hook has its own timeout. A second signal exits immediately.
+The signals are captured from New, so a signal received while the components start still runs the hooks
+*/
+type Lifecycle struct {
+	mtx     sync.Mutex
+	logger  log.Logger
+	timeout time.Duration
+	hooks   []hook
+	fatal   chan error
+	signals chan os.Signal
+	code    chan int // exit code, once the shutdown started
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func New(logger log.Logger, timeout time.Duration) *Lifecycle {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lifecycle{
+		logger:  logger,
+		timeout: timeout,
+		fatal:   make(chan error, 1),
+		signals: make(chan os.Signal, 2),
+		code:    make(chan int, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	signal.Notify(l.signals, syscall.SIGINT, syscall.SIGTERM)
+	go l.waitShutdown()
+	return l
+}
+
+// waitShutdown cancels the context on the first signal or fatal error, so the components still starting give up
+func (l *Lifecycle) waitShutdown() {
+	code := ExitOk
+	select {
+	case sig := <-l.signals:
+		l.logger.Info(fmt.Sprintf("Captured %s, shutting down", sig))
+	case err := <-l.fatal:
+		l.logger.Error("Fatal error, shutting down: " + err.Error())
+		code = ExitFatal
+	}
+	l.cancel()
+	l.code <- code
+}
+
+// OnStop registers a hook run on shutdown, after the hooks registered before it
+func (l *Lifecycle) OnStop(name string, stop func(ctx context.Context) error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.hooks = append(l.hooks, hook{name, stop})
+}
+
+// Context is cancelled when the shutdown starts, the background loops stop on it
+func (l *Lifecycle) Context() context.Context {
+	return l.ctx
+}
+
+// Fatal starts the shutdown because a component can't run anymore
+func (l *Lifecycle) Fatal(err error) {
+	select {
+	case l.fatal <- err:
+	default: // already shutting down
+	}
+}
+
+// Wait blocks until a signal or a fatal error, runs the stop hooks and returns the exit code of the process
+func (l *Lifecycle) Wait() int {
+	code := <-l.code
+
+	done := make(chan bool, 1)
+	go func() {
+		done <- l.runHooks()
+	}()
+	select {
+	case ok := <-done:
+		if !ok && code == ExitOk {
+			code = ExitShutdownFailed
+		}
+	case sig := <-l.signals:
+		l.logger.Error(fmt.Sprintf("Captured %s again, exiting without waiting for the shutdown", sig))
+		return ExitForced
+	}
+	l.logger.Info("Shutdown complete", "code", code)
+	return code
+}
+
+// runHooks runs the stop hooks in order, each one within the shutdown timeout. A hook which doesn't finish in time
+// is abandoned and the next ones still run, so a stuck component doesn't prevent the others from stopping.
+// It returns false if one of them failed or timed out
+func (l *Lifecycle) runHooks() bool {
+	l.mtx.Lock()
+	hooks := append([]hook(nil), l.hooks...)
+	l.mtx.Unlock()
+
+	ok := true
+	for _, h := range hooks {
+		l.logger.Info("Stopping " + h.name)
+		if err := l.runHook(h); err != nil {
+			l.logger.Error(fmt.Sprintf("Failed to stop %s: %s", h.name, err.Error()))
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (l *Lifecycle) runHook(h hook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- h.stop(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timeout after %s", l.timeout)
+	}
+}
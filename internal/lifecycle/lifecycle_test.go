@@ -0,0 +1,99 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/HighStakesSwitzerland/tendermint/libs/log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunHooks(t *testing.T) {
+	stuck := func(ctx context.Context) error {
+		select {} // ignores ctx, like a component which doesn't stop
+	}
+	waiting := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	failing := func(ctx context.Context) error {
+		return errors.New("failed")
+	}
+	stopped := func(ctx context.Context) error {
+		return nil
+	}
+
+	tests := []struct {
+		name  string
+		hooks []func(ctx context.Context) error
+		ok    bool
+	}{
+		{"all stopped", []func(ctx context.Context) error{stopped, stopped}, true},
+		{"no hooks", nil, true},
+		{"failed hook", []func(ctx context.Context) error{failing, stopped}, false},
+		{"stuck hook", []func(ctx context.Context) error{stuck, stopped}, false},
+		{"hook waiting for the timeout", []func(ctx context.Context) error{waiting, stopped}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(log.NewNopLogger(), 50*time.Millisecond)
+			ran := make([]int32, len(tt.hooks))
+			for i, stop := range tt.hooks {
+				i, stop := i, stop
+				l.OnStop(tt.name, func(ctx context.Context) error {
+					atomic.StoreInt32(&ran[i], 1)
+					return stop(ctx)
+				})
+			}
+
+			done := make(chan bool, 1)
+			go func() {
+				done <- l.runHooks()
+			}()
+			select {
+			case ok := <-done:
+				if ok != tt.ok {
+					t.Errorf("runHooks() = %v, want %v", ok, tt.ok)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("runHooks() did not return, a hook was not abandoned after its timeout")
+			}
+			for i := range ran {
+				if atomic.LoadInt32(&ran[i]) == 0 {
+					t.Errorf("hook %d did not run", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSignalBeforeWait(t *testing.T) {
+	l := New(log.NewNopLogger(), 50*time.Millisecond)
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// received while the components start, before the hooks are registered
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skip("can't send a signal: " + err.Error())
+	}
+	select {
+	case <-l.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("the context was not cancelled by the signal")
+	}
+
+	var ran int32
+	l.OnStop("component", func(ctx context.Context) error {
+		atomic.StoreInt32(&ran, 1)
+		return nil
+	})
+	if code := l.Wait(); code != ExitOk {
+		t.Errorf("Wait() = %d, want %d", code, ExitOk)
+	}
+	if atomic.LoadInt32(&ran) == 0 {
+		t.Error("the stop hook did not run")
+	}
+}
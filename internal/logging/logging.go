@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/libs/log"
+	"strings"
+	"sync"
+)
+
+const (
+	LevelNone = "none"
+
+	// P2PModule is the module of the tendermint switch, transport and pex reactor of the chains
+	P2PModule = "p2p"
+)
+
+/*
+Levels is parsed from the log_level config, i.e. "info,geoloc=debug,p2p=error,p2p.cosmoshub-4=debug":
+a default level followed by per-module levels. The p2p logs are noisy, they are disabled unless a p2p level is set
+*/
+type Levels struct {
+	Default string
+	Modules map[string]string
+}
+
+// Loggers creates the logger of every module, with the format and the level of the config
+type Loggers struct {
+	mtx     sync.Mutex
+	format  string
+	levels  Levels
+	loggers map[string]log.Logger
+}
+
+func ParseLevels(logLevel string) (Levels, error) {
+	levels := Levels{Default: log.LogLevelInfo, Modules: make(map[string]string)}
+	for _, part := range strings.Split(logLevel, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		module, level := "", part
+		if i := strings.Index(part, "="); i >= 0 {
+			module, level = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+			if module == "" {
+				return levels, fmt.Errorf("missing module name in %q", part)
+			}
+		}
+		if err := checkLevel(level); err != nil {
+			return levels, err
+		}
+		if module == "" {
+			levels.Default = level
+		} else {
+			levels.Modules[module] = level
+		}
+	}
+	return levels, nil
+}
+
+func checkLevel(level string) error {
+	switch level {
+	case log.LogLevelDebug, log.LogLevelInfo, log.LogLevelWarn, log.LogLevelError, LevelNone:
+		return nil
+	}
+	return fmt.Errorf("unknown log level %q, expected debug, info, warn, error or none", level)
+}
+
+func CheckFormat(format string) error {
+	switch format {
+	case "", log.LogFormatText, log.LogFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q, expected text or json", format)
+}
+
+func New(format string, logLevel string) (*Loggers, error) {
+	if err := CheckFormat(format); err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = log.LogFormatText
+	}
+	levels, err := ParseLevels(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &Loggers{format: format, levels: levels, loggers: make(map[string]log.Logger)}, nil
+}
+
+// Module returns the logger of a module, its entries have a module field
+func (l *Loggers) Module(module string) log.Logger {
+	return l.logger(module, l.level(module))
+}
+
+// Chain returns the p2p logger of a chain, its level is the one of p2p.<chain_id>, else the one of p2p
+func (l *Loggers) Chain(chainId string) log.Logger {
+	level, ok := l.levels.Modules[P2PModule+"."+chainId]
+	if !ok {
+		level = l.level(P2PModule)
+	}
+	return l.logger(P2PModule, level).With("chain", chainId)
+}
+
+func (l *Loggers) level(module string) string {
+	if level, ok := l.levels.Modules[module]; ok {
+		return level
+	}
+	if module == P2PModule {
+		return LevelNone
+	}
+	return l.levels.Default
+}
+
+// logger creates one logger per module and level, they are shared by the chains
+func (l *Loggers) logger(module string, level string) log.Logger {
+	if level == LevelNone {
+		return log.NewNopLogger()
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	key := module + "=" + level
+	if logger, ok := l.loggers[key]; ok {
+		return logger
+	}
+	logger := log.MustNewDefaultLogger(l.format, level, false).With("module", module)
+	l.loggers[key] = logger
+	return logger
+}
@@ -0,0 +1,165 @@
+package seednode
+
+import (
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/crypto"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	bestPeersMaxAge      = 7 * 24 * time.Hour // peers not connected since are not recommended
+	bestPeersMaxAttempts = 3                  // failed dials since the last success
+)
+
+/*
+BestPeers selects up to n peers of an address book to recommend to node operators: peers we connected to recently
+and didn't fail to dial or probe since, spread over as many ASNs and countries as possible. The peers found reachable
+by the last probe come first, fastest handshake first, then the others, most recently connected first.
+The best ranked peer of an ASN and country not selected yet is taken first, n <= 0 returns all of them.
+probes are the last probes of the chain, nil if unknown
+*/
+func BestPeers(addresses []*pex.KnownAddress, probes map[types.NodeID]ProbeResult, n int) []*pex.KnownAddress {
+	candidates := make([]*pex.KnownAddress, 0, len(addresses))
+	minSuccess := time.Now().Add(-bestPeersMaxAge)
+	reachable := make(map[*pex.KnownAddress]ProbeResult)
+	for _, address := range addresses {
+		if address.Addr == nil || !address.Addr.Routable() || address.LastSuccess.Before(minSuccess) ||
+			address.Attempts >= bestPeersMaxAttempts || address.LastBanTime.After(address.LastSuccess) {
+			continue
+		}
+		if probe, ok := probes[address.ID()]; ok && probe.IP.Equal(address.Addr.IP) {
+			if !probe.Reachable && probe.ProbedAt.After(address.LastSuccess) {
+				continue // known dead since we last saw it
+			}
+			if probe.Reachable {
+				reachable[address] = probe
+			}
+		}
+		candidates = append(candidates, address)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		probeI, reachableI := reachable[candidates[i]]
+		probeJ, reachableJ := reachable[candidates[j]]
+		if reachableI != reachableJ {
+			return reachableI
+		}
+		if reachableI && probeI.Latency != probeJ.Latency {
+			return probeI.Latency < probeJ.Latency
+		}
+		return candidates[i].LastSuccess.After(candidates[j].LastSuccess)
+	})
+	if n <= 0 || n > len(candidates) {
+		n = len(candidates)
+	}
+
+	selected := make([]*pex.KnownAddress, 0, n)
+	asCount := make(map[string]int)
+	countryCount := make(map[string]int)
+	for len(selected) < n {
+		best := -1
+		for i, candidate := range candidates {
+			if candidate == nil {
+				continue
+			}
+			// fewest peers already selected in the same ASN, then in the same country, then best ranked
+			if best < 0 || asCount[asNumberOf(candidate)] < asCount[asNumberOf(candidates[best])] ||
+				asCount[asNumberOf(candidate)] == asCount[asNumberOf(candidates[best])] &&
+					countryCount[candidate.Country] < countryCount[candidates[best].Country] {
+				best = i
+			}
+		}
+		address := candidates[best]
+		candidates[best] = nil
+		asCount[asNumberOf(address)]++
+		countryCount[address.Country]++
+		selected = append(selected, address)
+	}
+	return selected
+}
+
+// asNumberOf returns the AS number of a resolved address, i.e. AS16509 for "AS16509 Amazon.com, Inc."
+func asNumberOf(address *pex.KnownAddress) string {
+	if fields := strings.Fields(address.As); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// PeersString returns the addresses as a nodeid@ip:port list, as expected by persistent_peers and seeds
+func PeersString(addresses []*pex.KnownAddress) string {
+	peers := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		peers = append(peers, address.Addr.String())
+	}
+	return strings.Join(peers, ",")
+}
+
+// tmKnownAddress is an address book entry without our geolocation fields, as saved by tendermint nodes
+type tmKnownAddress struct {
+	Addr        *p2p.NetAddress `json:"addr"`
+	Src         *p2p.NetAddress `json:"src"`
+	Buckets     []int           `json:"buckets"`
+	Attempts    int32           `json:"attempts"`
+	BucketType  byte            `json:"bucket_type"`
+	LastAttempt time.Time       `json:"last_attempt"`
+	LastSuccess time.Time       `json:"last_success"`
+	LastBanTime time.Time       `json:"last_ban_time"`
+}
+
+// TendermintAddrBook is the content of an addrbook.json file which tendermint nodes can load
+type TendermintAddrBook struct {
+	Key   string           `json:"key"`
+	Addrs []tmKnownAddress `json:"addrs"`
+}
+
+/*
+NewTendermintAddrBook builds an address book holding the given addresses, with a new random key. The buckets of our
+address book were computed with our key, so the addresses are added to a new tendermint address book, kept in memory,
+to compute their buckets, the known good addresses being moved to the old buckets. Their history is kept.
+The addresses tendermint refuses (invalid, banned...) are skipped
+*/
+func NewTendermintAddrBook(addresses []*pex.KnownAddress) TendermintAddrBook {
+	book := pex.NewAddrBook("", false)
+	for _, address := range addresses {
+		src := address.Src
+		if src == nil {
+			src = address.Addr
+		}
+		if err := book.AddAddress(address.Addr, src); err != nil {
+			logger.Info(fmt.Sprintf("Skipping %s in the exported address book: %s", address.Addr, err))
+			continue
+		}
+		if address.BucketType == bucketTypeOld {
+			book.MarkGood(address.ID())
+		}
+	}
+
+	added := make(map[types.NodeID]*pex.KnownAddress)
+	for _, address := range book.GetAddrbookContent() {
+		added[address.ID()] = address
+	}
+	addrBook := TendermintAddrBook{Key: crypto.CRandHex(24), Addrs: make([]tmKnownAddress, 0, len(added))}
+	for _, address := range addresses {
+		bucketed, ok := added[address.ID()]
+		if !ok {
+			continue
+		}
+		delete(added, address.ID()) // listed once if given twice
+		addrBook.Addrs = append(addrBook.Addrs, tmKnownAddress{
+			Addr:        bucketed.Addr,
+			Src:         bucketed.Src,
+			Buckets:     bucketed.Buckets,
+			Attempts:    address.Attempts,
+			BucketType:  bucketed.BucketType,
+			LastAttempt: address.LastAttempt,
+			LastSuccess: address.LastSuccess,
+			LastBanTime: address.LastBanTime,
+		})
+	}
+	return addrBook
+}
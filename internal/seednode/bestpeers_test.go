@@ -0,0 +1,137 @@
+package seednode
+
+import (
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func knownAddress(i int, as, country string, lastSuccess time.Time) *pex.KnownAddress {
+	return &pex.KnownAddress{
+		Addr:        &p2p.NetAddress{ID: types.NodeID(fmt.Sprintf("%040d", i)), IP: net.IPv4(8, 8, 8, byte(i)), Port: 26656},
+		LastSuccess: lastSuccess,
+		Country:     country,
+		As:          as,
+	}
+}
+
+func TestBestPeers(t *testing.T) {
+	now := time.Now()
+	a := knownAddress(1, "AS16509 Amazon.com, Inc.", "US", now.Add(-time.Hour))
+	b := knownAddress(2, "AS16509 Amazon.com, Inc.", "US", now.Add(-2*time.Hour))
+	c := knownAddress(3, "AS24940 Hetzner Online GmbH", "DE", now.Add(-3*time.Hour))
+	d := knownAddress(4, "AS24940 Hetzner Online GmbH", "FI", now.Add(-4*time.Hour))
+	old := knownAddress(5, "AS16276 OVH SAS", "FR", now.Add(-2*bestPeersMaxAge))
+	failing := knownAddress(6, "AS16276 OVH SAS", "FR", now.Add(-time.Hour))
+	failing.Attempts = bestPeersMaxAttempts
+	banned := knownAddress(7, "AS16276 OVH SAS", "FR", now.Add(-time.Hour))
+	banned.LastBanTime = now
+	private := knownAddress(8, "", "", now.Add(-time.Hour))
+	private.Addr.IP = net.IPv4(192, 168, 1, 8)
+
+	probe := func(address *pex.KnownAddress, reachable bool, probedAt time.Time, latency time.Duration) ProbeResult {
+		return ProbeResult{IP: address.Addr.IP, Port: address.Addr.Port, Reachable: reachable, ProbedAt: probedAt,
+			Latency: latency}
+	}
+
+	tests := []struct {
+		name      string
+		addresses []*pex.KnownAddress
+		probes    map[types.NodeID]ProbeResult
+		n         int
+		want      []*pex.KnownAddress
+	}{
+		{"no addresses", nil, nil, 3, []*pex.KnownAddress{}},
+		{"filtered out", []*pex.KnownAddress{old, failing, banned, private}, nil, 0, []*pex.KnownAddress{}},
+		{"most recent first", []*pex.KnownAddress{b, a}, nil, 0, []*pex.KnownAddress{a, b}},
+		{"spread over ASNs", []*pex.KnownAddress{a, b, c, d}, nil, 2, []*pex.KnownAddress{a, c}},
+		{"then over countries", []*pex.KnownAddress{a, b, c, d}, nil, 0, []*pex.KnownAddress{a, c, d, b}},
+		{
+			"dead since the last success",
+			[]*pex.KnownAddress{a, b},
+			map[types.NodeID]ProbeResult{a.ID(): probe(a, false, now, 0)},
+			0,
+			[]*pex.KnownAddress{b},
+		},
+		{
+			"unreachable before the last success",
+			[]*pex.KnownAddress{a, b},
+			map[types.NodeID]ProbeResult{a.ID(): probe(a, false, now.Add(-2*time.Hour), 0)},
+			0,
+			[]*pex.KnownAddress{a, b},
+		},
+		{
+			"probe of another ip",
+			[]*pex.KnownAddress{a, b},
+			map[types.NodeID]ProbeResult{a.ID(): {IP: net.IPv4(8, 8, 4, 4), ProbedAt: now}},
+			0,
+			[]*pex.KnownAddress{a, b},
+		},
+		{
+			"reachable first, fastest first",
+			[]*pex.KnownAddress{a, b, c},
+			map[types.NodeID]ProbeResult{
+				b.ID(): probe(b, true, now, 200*time.Millisecond),
+				c.ID(): probe(c, true, now, 100*time.Millisecond),
+			},
+			0,
+			[]*pex.KnownAddress{c, b, a},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BestPeers(tt.addresses, tt.probes, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BestPeers() = %s, want %s", PeersString(got), PeersString(tt.want))
+			}
+		})
+	}
+}
+
+func TestNewTendermintAddrBook(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	fresh := knownAddress(1, "", "", now)
+	fresh.Src = fresh.Addr
+	fresh.BucketType = bucketTypeNew
+	good := knownAddress(2, "", "", now.Add(-time.Hour))
+	good.Src = fresh.Addr
+	good.BucketType = bucketTypeOld
+	good.Attempts = 1
+	good.LastAttempt = now
+
+	invalid := knownAddress(3, "", "", now)
+	invalid.Addr.IP = net.IPv4zero
+	invalid.BucketType = bucketTypeNew
+
+	addrBook := NewTendermintAddrBook([]*pex.KnownAddress{fresh, invalid, good})
+	if addrBook.Key == "" {
+		t.Error("NewTendermintAddrBook() has no key")
+	}
+	if len(addrBook.Addrs) != 2 {
+		t.Fatalf("NewTendermintAddrBook() has %d addresses, want 2", len(addrBook.Addrs))
+	}
+	if addrBook.Addrs[0].Addr.ID != fresh.ID() || addrBook.Addrs[1].Addr.ID != good.ID() {
+		t.Errorf("NewTendermintAddrBook() = %s, %s, want %s, %s",
+			addrBook.Addrs[0].Addr, addrBook.Addrs[1].Addr, fresh.Addr, good.Addr)
+	}
+	for _, exported := range addrBook.Addrs {
+		want := fresh
+		if exported.Addr.ID == good.ID() {
+			want = good
+		}
+		if len(exported.Buckets) == 0 {
+			t.Errorf("%s is in no bucket", exported.Addr)
+		}
+		if exported.BucketType != want.BucketType {
+			t.Errorf("%s bucket type = %d, want %d", exported.Addr, exported.BucketType, want.BucketType)
+		}
+		if exported.Attempts != want.Attempts || !exported.LastAttempt.Equal(want.LastAttempt) ||
+			!exported.LastSuccess.Equal(want.LastSuccess) {
+			t.Errorf("%s history = %+v, want the one of %+v", exported.Addr, exported, want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package seednode
+
+import (
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	mrand "math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCrawlInterval     = 60 * time.Second
+	defaultCrawlBatchSize    = 30
+	defaultCrawlConcurrency  = 10
+	defaultCrawlResponseWait = 30 * time.Second
+	defaultRecrawlAfter      = time.Hour
+	crawlBanTime             = 24 * time.Hour // same as the pex reactor, for peers failing the authentication
+)
+
+// crawl results, used as metrics label
+const (
+	crawlResponded  = "responded"
+	crawlNoResponse = "no_response"
+	crawlFailed     = "unreachable"
+)
+
+/*
+Crawler actively explores the network of a chain. On every round, it dials the addresses of the address book
+which were not crawled for the longest time, asks them for their peers with a PEX request and disconnects them
+once they answered. The peers which answer are marked good in the address book, the unreachable ones as a failed
+attempt, so the address book converges on the reachable network instead of the peers which happened to connect to us.
+The pex reactor crawls the address book too in seed mode, but only a small random selection every 30 seconds, and it
+neither waits for the answers nor records who answered, which is why both run. The addresses the reactor dialed count
+as crawled, so the crawler doesn't dial them again before recrawl_after. The reactor can't be told about our crawls,
+its record is internal: it may dial a peer we crawled, at most once every 2 minutes
+*/
+type Crawler struct {
+	mtx        sync.Mutex
+	cfg        config.CrawlerConfig
+	sw         *p2p.Switch
+	addrBook   pex.AddrBook
+	pexReactor *pex.Reactor
+	labels     []string
+	crawled    map[types.NodeID]time.Time // last crawl of the addresses
+	waiting    map[types.NodeID]chan int  // dialed peers, waiting for their PEX response
+	stats      CrawlerStats
+	quit       chan struct{}
+	stopOnce   sync.Once
+}
+
+// CrawlerStats counts the crawls of a chain since it started
+type CrawlerStats struct {
+	Rounds            int        `json:"rounds"`
+	LastRound         *time.Time `json:"last_round,omitempty"`
+	Crawled           int        `json:"crawled"`     // addresses dialed
+	Responded         int        `json:"responded"`   // peers which sent their addresses
+	Unreachable       int        `json:"unreachable"` // dial failures
+	AddressesReceived int        `json:"addresses_received"`
+}
+
+func newCrawler(cfg config.CrawlerConfig, sw *p2p.Switch, addrBook pex.AddrBook, pexReactor *pex.Reactor, labels []string) *Crawler {
+	return &Crawler{
+		cfg:        cfg,
+		sw:         sw,
+		addrBook:   addrBook,
+		pexReactor: pexReactor,
+		labels:     labels,
+		crawled:    make(map[types.NodeID]time.Time),
+		waiting:    make(map[types.NodeID]chan int),
+		quit:       make(chan struct{}),
+	}
+}
+
+// Start runs the rounds in the background until Stop is called. A disabled crawler only waits to be enabled
+func (c *Crawler) Start() {
+	go func() {
+		for {
+			timer := time.NewTimer(c.config().Interval)
+			select {
+			case <-timer.C:
+				if c.config().Enabled {
+					c.round()
+				}
+			case <-c.quit:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the rounds. The dials in progress are not waited for, they fail once the switch is stopped
+func (c *Crawler) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+// SetConfig applies a new configuration from the next round
+func (c *Crawler) SetConfig(cfg config.CrawlerConfig) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.cfg = cfg
+}
+
+// config returns the configuration with the defaults applied
+func (c *Crawler) config() config.CrawlerConfig {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	cfg := c.cfg
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultCrawlInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultCrawlBatchSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultCrawlConcurrency
+	}
+	if cfg.ResponseTimeout <= 0 {
+		cfg.ResponseTimeout = defaultCrawlResponseWait
+	}
+	if cfg.RecrawlAfter <= 0 {
+		cfg.RecrawlAfter = defaultRecrawlAfter
+	}
+	return cfg
+}
+
+// Stats returns the counters of the crawler
+func (c *Crawler) Stats() CrawlerStats {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stats := c.stats
+	if stats.LastRound != nil {
+		lastRound := *stats.LastRound
+		stats.LastRound = &lastRound
+	}
+	return stats
+}
+
+func (c *Crawler) round() {
+	cfg := c.config()
+	addresses := c.selectAddresses(cfg)
+
+	results := make(chan crawlResult, len(addresses))
+	forEachAddress(addresses, cfg.Concurrency, c.quit, func(addr *p2p.NetAddress) {
+		results <- c.crawl(addr, cfg.ResponseTimeout)
+	})
+	close(results)
+	select {
+	case <-c.quit:
+		return // stopped, the metrics of the chain are deleted
+	default:
+	}
+
+	now := time.Now()
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	round := CrawlerStats{}
+	for result := range results {
+		if result.status == "" {
+			continue // stopped, or connected in the meantime
+		}
+		round.Crawled++
+		switch result.status {
+		case crawlResponded:
+			round.Responded++
+			round.AddressesReceived += result.addresses
+		case crawlFailed:
+			round.Unreachable++
+		}
+		crawls.WithLabelValues(c.labels[0], c.labels[1], result.status).Inc()
+		crawledAddresses.WithLabelValues(c.labels...).Add(float64(result.addresses))
+	}
+	c.stats.Rounds++
+	c.stats.LastRound = &now
+	c.stats.Crawled += round.Crawled
+	c.stats.Responded += round.Responded
+	c.stats.Unreachable += round.Unreachable
+	c.stats.AddressesReceived += round.AddressesReceived
+	if round.Crawled == 0 {
+		return
+	}
+	logger.Debug(fmt.Sprintf("Crawled %d addresses of chain %s: %d responded with %d addresses, %d unreachable",
+		round.Crawled, c.labels[0], round.Responded, round.AddressesReceived, round.Unreachable))
+}
+
+// selectAddresses returns the addresses of the address book which were not crawled for the longest time
+func (c *Crawler) selectAddresses(cfg config.CrawlerConfig) []*p2p.NetAddress {
+	content := c.addrBook.GetAddrbookContent()
+	mrand.Shuffle(len(content), func(i, j int) {
+		content[i], content[j] = content[j], content[i]
+	})
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	now := time.Now()
+	known := make(map[types.NodeID]bool, len(content))
+	candidates := make([]*p2p.NetAddress, 0)
+	for _, address := range content {
+		if address.Addr == nil {
+			continue
+		}
+		known[address.Addr.ID] = true
+		if lastCrawl, ok := c.crawled[address.Addr.ID]; ok && now.Sub(lastCrawl) < cfg.RecrawlAfter {
+			continue
+		}
+		if c.sw.IsDialingOrExistingAddress(address.Addr) || c.addrBook.IsBanned(address.Addr) {
+			continue
+		}
+		candidates = append(candidates, address.Addr)
+	}
+	for id := range c.crawled {
+		if !known[id] {
+			delete(c.crawled, id) // removed from the address book
+		}
+	}
+
+	// never crawled first, as their zero time is the oldest
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return c.crawled[candidates[i].ID].Before(c.crawled[candidates[j].ID])
+	})
+	if len(candidates) > cfg.BatchSize {
+		candidates = candidates[:cfg.BatchSize]
+	}
+	for _, addr := range candidates {
+		c.crawled[addr.ID] = now
+	}
+	return candidates
+}
+
+// forEachAddress calls fn for the addresses, concurrency at a time, and returns once they are done.
+// The addresses not started yet are skipped when quit is closed
+func forEachAddress(addresses []*p2p.NetAddress, concurrency int, quit <-chan struct{}, fn func(addr *p2p.NetAddress)) {
+	jobs := make(chan *p2p.NetAddress)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(addresses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for addr := range jobs {
+				fn(addr)
+			}
+		}()
+	}
+	for _, addr := range addresses {
+		select {
+		case jobs <- addr:
+		case <-quit:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+type crawlResult struct {
+	status    string // empty if the address was not crawled
+	addresses int
+}
+
+// crawl dials an address, asks for its peers and disconnects it
+func (c *Crawler) crawl(addr *p2p.NetAddress, timeout time.Duration) crawlResult {
+	select {
+	case <-c.quit:
+		return crawlResult{}
+	default:
+	}
+
+	response := make(chan int, 1)
+	c.mtx.Lock()
+	c.waiting[addr.ID] = response
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		delete(c.waiting, addr.ID)
+		c.mtx.Unlock()
+	}()
+
+	if err := c.sw.DialPeerWithAddress(addr); err != nil {
+		switch err.(type) {
+		case p2p.ErrCurrentlyDialingOrExistingAddress:
+			return crawlResult{}
+		case p2p.ErrSwitchAuthenticationFailure:
+			c.addrBook.MarkBad(addr, crawlBanTime)
+		default:
+			c.addrBook.MarkAttempt(addr)
+		}
+		return crawlResult{status: crawlFailed}
+	}
+	peer := c.sw.Peers().Get(addr.ID)
+	if peer == nil {
+		return crawlResult{status: crawlNoResponse} // disconnected right away
+	}
+	c.pexReactor.RequestAddrs(peer)
+
+	result := crawlResult{status: crawlNoResponse}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case result.addresses = <-response:
+		result.status = crawlResponded
+		c.addrBook.MarkGood(addr.ID)
+	case <-timer.C:
+	case <-c.quit:
+	}
+	if !peer.IsPersistent() {
+		c.sw.StopPeerGracefully(peer)
+	}
+	return result
+}
+
+// dialed records a dial of the pex reactor, or of the crawler itself, successful or not
+func (c *Crawler) dialed(id types.NodeID) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.crawled[id] = time.Now()
+}
+
+// pexResponse is called by the pex reactor when a peer sends its addresses
+func (c *Crawler) pexResponse(id types.NodeID, addresses int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if response, ok := c.waiting[id]; ok {
+		select {
+		case response <- addresses:
+		default:
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package seednode
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Health records the activity of a running chain: when it last had a peer, exchanged addresses or was geolocated
+type Health struct {
+	mtx        sync.Mutex
+	startedAt  time.Time
+	lastPeer   time.Time // last time a peer was added or removed, so the chain had at least one peer until then
+	lastPex    time.Time
+	lastGeoloc time.Time
+}
+
+func newHealth() *Health {
+	return &Health{startedAt: time.Now()}
+}
+
+func (h *Health) peerSeen() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.lastPeer = time.Now()
+}
+
+func (h *Health) pexExchanged() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.lastPex = time.Now()
+}
+
+// GeolocDone records a geolocation round of the chain, called by the geoloc scheduler
+func (h *Health) GeolocDone() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.lastGeoloc = time.Now()
+}
+
+// ChainHealth is the health report of a configured chain, running or not
+type ChainHealth struct {
+	ChainId       string        `json:"chain_id"`
+	PrettyName    string        `json:"pretty_name"`
+	Healthy       bool          `json:"healthy"`
+	Reason        string        `json:"reason,omitempty"` // why the chain is not healthy
+	NoPeers       bool          `json:"no_peers"`         // running without peers for longer than the timeout
+	SwitchRunning bool          `json:"switch_running"`
+	Listening     bool          `json:"listening"` // the listen address is bound
+	InboundPeers  int           `json:"inbound_peers"`
+	OutboundPeers int           `json:"outbound_peers"`
+	DialingPeers  int           `json:"dialing_peers"`
+	AddrBookSize  int           `json:"addrbook_size"`
+	StartedAt     *time.Time    `json:"started_at,omitempty"`
+	LastPeer      *time.Time    `json:"last_peer,omitempty"`
+	LastPex       *time.Time    `json:"last_pex_exchange,omitempty"`
+	LastGeoloc    *time.Time    `json:"last_geoloc,omitempty"`
+	Crawler       *CrawlerStats `json:"crawler,omitempty"`
+	Prober        *ProberStats  `json:"prober,omitempty"`
+	ChainStatus                 // state, and the error of a failed chain
+}
+
+/*
+Health checks a configured chain. It is unhealthy when it doesn't run, when its switch or listener is down,
+or when it has had no peer for longer than noPeersTimeout. A zero noPeersTimeout disables the peers check
+*/
+func (m *Manager) Health(chainId string, noPeersTimeout time.Duration) (ChainHealth, error) {
+	status, ok := m.Status(chainId)
+	if !ok {
+		return ChainHealth{}, fmt.Errorf("%w: %s", ErrUnknownChain, chainId)
+	}
+	report := ChainHealth{ChainId: chainId, ChainStatus: status}
+	seedNode, running := m.Get(chainId)
+	if !running {
+		report.PrettyName = m.prettyName(chainId)
+		report.Reason = "chain is " + string(status.State)
+		return report, nil
+	}
+
+	report.PrettyName = seedNode.Cfg.PrettyName
+	report.SwitchRunning = seedNode.Sw.IsRunning()
+	report.Listening = len(seedNode.Transport.Endpoints()) > 0
+	report.OutboundPeers, report.InboundPeers, report.DialingPeers = seedNode.Sw.NumPeers()
+	report.AddrBookSize = seedNode.AddrBook.Size()
+	crawlerStats := seedNode.Crawler.Stats()
+	report.Crawler = &crawlerStats
+	proberStats := seedNode.Prober.Stats()
+	report.Prober = &proberStats
+
+	seedNode.Health.mtx.Lock()
+	startedAt, lastPeer := seedNode.Health.startedAt, seedNode.Health.lastPeer
+	report.StartedAt = timeOrNil(startedAt)
+	report.LastPeer = timeOrNil(lastPeer)
+	report.LastPex = timeOrNil(seedNode.Health.lastPex)
+	report.LastGeoloc = timeOrNil(seedNode.Health.lastGeoloc)
+	seedNode.Health.mtx.Unlock()
+
+	since := lastPeer
+	if since.IsZero() {
+		since = startedAt
+	}
+	switch {
+	case !report.SwitchRunning:
+		report.Reason = "switch is not running"
+	case !report.Listening:
+		report.Reason = "listener is not bound"
+	case noPeersTimeout > 0 && report.InboundPeers+report.OutboundPeers == 0 && time.Since(since) > noPeersTimeout:
+		report.Reason = fmt.Sprintf("no peers for %s", time.Since(since).Truncate(time.Second))
+		report.NoPeers = true
+	}
+	report.Healthy = report.Reason == ""
+	return report, nil
+}
+
+func (m *Manager) prettyName(chainId string) string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if cfg, ok := m.configs[chainId]; ok {
+		return cfg.PrettyName
+	}
+	return ""
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,558 @@
+package seednode
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	tmstrings "github.com/HighStakesSwitzerland/tendermint/libs/strings"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+var (
+	ErrUnknownChain    = errors.New("unknown chain")
+	ErrChainRunning    = errors.New("chain is already running")
+	ErrChainNotRunning = errors.New("chain is not running")
+	ErrInvalidPeers    = errors.New("invalid bootstrap peers")
+	ErrShuttingDown    = errors.New("shutting down")
+)
+
+/*
+Manager keeps track of the running seed nodes, so chains can be started and stopped at runtime
+without touching the other ones. A chain which fails to start is retried with an exponential backoff,
+the other chains keep running.
+The configs of the chains are never modified once stored, they are replaced by a modified copy, so the ones returned
+by Get, List and Configs can be read without lock.
+Starting and stopping a chain is slow (listen, dials, address book save), so it is done under the lock of the chain
+only, which serializes the operations on the chain. mtx is held only to read and swap the maps, the other chains and
+the readers are never blocked by a chain. A chain lock is always taken before mtx, never while holding it
+*/
+type Manager struct {
+	mtx        sync.RWMutex
+	nodeKey    *types.NodeKey // shared by the chains without node_key_file
+	explorers  explorersConfig
+	hooks      Hooks
+	configs    map[string]*config.P2PConfig // configured chains, running or not, keyed by chain id
+	nodes      map[string]*SeedNodeConfig   // running chains, keyed by chain id
+	order      []string                     // chain ids, in the order they were started
+	failures   map[string]*failure          // chains which failed to start, keyed by chain id
+	stopped    map[string]bool              // chains stopped with Stop, not started again by Apply
+	chainLocks map[string]*sync.Mutex       // serialize the start and stop of every chain, keyed by chain id
+	closed     bool                         // set by StopAll, no chain can be started anymore
+}
+
+// Hooks are called when a chain is started or stopped, whatever the reason: config reload, admin API or retry
+type Hooks struct {
+	Started func(seedNode SeedNodeConfig)
+	Stopped func(seedNode SeedNodeConfig)
+}
+
+// explorersConfig configures the crawler and the prober of the chains
+type explorersConfig struct {
+	crawler config.CrawlerConfig
+	prober  config.ProberConfig
+}
+
+type failure struct {
+	err       error
+	attempts  int
+	nextRetry time.Time
+	timer     *time.Timer
+}
+
+type ChainState string
+
+const (
+	ChainRunning ChainState = "running"
+	ChainStopped ChainState = "stopped"
+	ChainFailed  ChainState = "failed"
+)
+
+// ChainStatus tells whether a chain is running, and why it is not if it failed to start
+type ChainStatus struct {
+	State     ChainState `json:"state"`
+	Error     string     `json:"error,omitempty"`
+	Failures  int        `json:"failures,omitempty"`
+	NextRetry *time.Time `json:"next_retry,omitempty"`
+}
+
+// Changes is the result of applying a new configuration
+type Changes struct {
+	Started []SeedNodeConfig
+	Stopped []SeedNodeConfig
+	Updated []SeedNodeConfig
+}
+
+func NewManager(nodeKey *types.NodeKey, tsConfig *config.TSConfig, hooks Hooks) *Manager {
+	return &Manager{
+		nodeKey:    nodeKey,
+		explorers:  explorersConfig{tsConfig.Crawler, tsConfig.Prober},
+		hooks:      hooks,
+		configs:    make(map[string]*config.P2PConfig),
+		nodes:      make(map[string]*SeedNodeConfig),
+		failures:   make(map[string]*failure),
+		stopped:    make(map[string]bool),
+		chainLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// Start starts the seed node of a chain, if it is not running yet. If it fails, it is retried later
+func (m *Manager) Start(cfg *config.P2PConfig) error {
+	unlock := m.lockChain(cfg.ChainId)
+	defer unlock()
+	return m.start(copyConfig(cfg))
+}
+
+// StartChain starts a configured chain which was stopped
+func (m *Manager) StartChain(chainId string) error {
+	unlock := m.lockChain(chainId)
+	defer unlock()
+	m.mtx.RLock()
+	cfg, ok := m.configs[chainId]
+	m.mtx.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChain, chainId)
+	}
+	return m.start(cfg)
+}
+
+// Restart stops and starts again the seed node of a chain
+func (m *Manager) Restart(chainId string) error {
+	unlock := m.lockChain(chainId)
+	defer unlock()
+	m.mtx.RLock()
+	cfg := m.configs[chainId]
+	_, running := m.nodes[chainId]
+	_, failed := m.failures[chainId]
+	notRunningErr := m.notRunningError(chainId)
+	m.mtx.RUnlock()
+	if !running {
+		if failed {
+			return m.start(cfg)
+		}
+		return notRunningErr
+	}
+	if err := m.stop(chainId); err != nil {
+		return err
+	}
+	return m.start(cfg)
+}
+
+// lockChain takes the lock of a chain, and returns the function releasing it
+func (m *Manager) lockChain(chainId string) func() {
+	m.mtx.Lock()
+	lock, ok := m.chainLocks[chainId]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.chainLocks[chainId] = lock
+	}
+	m.mtx.Unlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// start starts a chain, its lock must be held
+func (m *Manager) start(cfg *config.P2PConfig) error {
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return fmt.Errorf("%w, chain %s is not started", ErrShuttingDown, cfg.ChainId)
+	}
+	m.configs[cfg.ChainId] = cfg
+	delete(m.stopped, cfg.ChainId)
+	_, running := m.nodes[cfg.ChainId]
+	explorers := m.explorers
+	m.mtx.Unlock()
+	if running {
+		return fmt.Errorf("%w: %s", ErrChainRunning, cfg.ChainId)
+	}
+
+	nodeKey, err := cfg.LoadNodeKey(m.nodeKey)
+	var seedNode *SeedNodeConfig
+	if err == nil {
+		seedNode, err = startSeedNode(cfg, nodeKey, explorers)
+	}
+
+	m.mtx.Lock()
+	if err != nil {
+		err = fmt.Errorf("failed to start chain %s: %w", cfg.ChainId, err)
+		m.scheduleRetry(cfg.ChainId, err)
+		m.mtx.Unlock()
+		return err
+	}
+	if m.closed { // StopAll was called while starting
+		m.mtx.Unlock()
+		stopSeedNode(seedNode)
+		return fmt.Errorf("%w, chain %s is stopped", ErrShuttingDown, cfg.ChainId)
+	}
+	m.cancelRetry(cfg.ChainId)
+	m.nodes[cfg.ChainId] = seedNode
+	m.order = append(m.order, cfg.ChainId)
+	m.mtx.Unlock()
+
+	if m.hooks.Started != nil {
+		m.hooks.Started(*seedNode)
+	}
+	return nil
+}
+
+// scheduleRetry starts the chain again later, doubling the delay after every failure. mtx must be held
+func (m *Manager) scheduleRetry(chainId string, err error) {
+	f, ok := m.failures[chainId]
+	if !ok {
+		f = &failure{}
+		m.failures[chainId] = f
+	} else if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.err = err
+	f.attempts++
+
+	delay := maxRetryDelay
+	if f.attempts < 10 {
+		if delay = minRetryDelay << (f.attempts - 1); delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+	f.nextRetry = time.Now().Add(delay)
+	f.timer = time.AfterFunc(delay, func() {
+		unlock := m.lockChain(chainId)
+		defer unlock()
+		m.mtx.RLock()
+		cfg, ok := m.configs[chainId]
+		retry := ok && m.failures[chainId] == f && !m.closed
+		m.mtx.RUnlock()
+		if retry { // else the chain was stopped, removed or started in the meantime
+			_ = m.start(cfg)
+		}
+	})
+	logger.Error(fmt.Sprintf("%s, retrying in %s", err.Error(), delay))
+}
+
+// cancelRetry forgets the failures of a chain. mtx must be held
+func (m *Manager) cancelRetry(chainId string) {
+	if f, ok := m.failures[chainId]; ok {
+		f.timer.Stop()
+		delete(m.failures, chainId)
+	}
+}
+
+// Stop stops the seed node of a chain and saves its address book. The retries of a failed chain are cancelled.
+// The chain stays stopped when the configuration is applied again, until it is started with StartChain or Restart
+func (m *Manager) Stop(chainId string) error {
+	unlock := m.lockChain(chainId)
+	defer unlock()
+	if err := m.stop(chainId); err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	if _, ok := m.configs[chainId]; ok {
+		m.stopped[chainId] = true
+	}
+	m.mtx.Unlock()
+	return nil
+}
+
+// stop stops a chain, its lock must be held
+func (m *Manager) stop(chainId string) error {
+	m.mtx.Lock()
+	seedNode, ok := m.nodes[chainId]
+	if !ok {
+		defer m.mtx.Unlock()
+		if _, failed := m.failures[chainId]; failed {
+			m.cancelRetry(chainId)
+			return nil
+		}
+		return m.notRunningError(chainId)
+	}
+	delete(m.nodes, chainId)
+	for i, id := range m.order {
+		if id == chainId {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	m.mtx.Unlock()
+
+	stopSeedNode(seedNode)
+	if m.hooks.Stopped != nil {
+		m.hooks.Stopped(*seedNode)
+	}
+	return nil
+}
+
+// notRunningError tells whether a chain is unknown or only not running. mtx must be held
+func (m *Manager) notRunningError(chainId string) error {
+	if _, ok := m.configs[chainId]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChain, chainId)
+	}
+	return fmt.Errorf("%w: %s", ErrChainNotRunning, chainId)
+}
+
+// SaveAll saves the address book of every running chain
+func (m *Manager) SaveAll() {
+	for _, seedNode := range m.List() {
+		seedNode.AddrBook.Save()
+	}
+}
+
+// StopAll stops every running seed node, in the order they were started, and prevents new ones from starting.
+// It waits for the chains being started, which are stopped right away
+func (m *Manager) StopAll() {
+	m.mtx.Lock()
+	m.closed = true
+	for chainId := range m.failures {
+		m.cancelRetry(chainId)
+	}
+	chainIds := append([]string(nil), m.order...)
+	for chainId := range m.configs {
+		if _, ok := m.nodes[chainId]; !ok {
+			chainIds = append(chainIds, chainId)
+		}
+	}
+	m.mtx.Unlock()
+
+	for _, chainId := range chainIds {
+		unlock := m.lockChain(chainId)
+		_ = m.stop(chainId)
+		unlock()
+	}
+}
+
+// SaveAddrBook writes the address book of a running chain to disk
+func (m *Manager) SaveAddrBook(chainId string) error {
+	m.mtx.RLock()
+	seedNode, ok := m.nodes[chainId]
+	var err error
+	if !ok {
+		err = m.notRunningError(chainId)
+	}
+	m.mtx.RUnlock()
+	if err != nil {
+		return err
+	}
+	seedNode.AddrBook.Save()
+	return nil
+}
+
+// Status returns the state of a configured chain
+func (m *Manager) Status(chainId string) (ChainStatus, bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if _, ok := m.configs[chainId]; !ok {
+		return ChainStatus{}, false
+	}
+	if _, ok := m.nodes[chainId]; ok {
+		return ChainStatus{State: ChainRunning}, true
+	}
+	if f, ok := m.failures[chainId]; ok {
+		nextRetry := f.nextRetry
+		return ChainStatus{State: ChainFailed, Error: f.err.Error(), Failures: f.attempts, NextRetry: &nextRetry}, true
+	}
+	return ChainStatus{State: ChainStopped}, true
+}
+
+// Get returns the seed node of a chain
+func (m *Manager) Get(chainId string) (SeedNodeConfig, bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	seedNode, ok := m.nodes[chainId]
+	if !ok {
+		return SeedNodeConfig{}, false
+	}
+	return *seedNode, true
+}
+
+// List returns the running seed nodes
+func (m *Manager) List() []SeedNodeConfig {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	seedNodes := make([]SeedNodeConfig, 0, len(m.order))
+	for _, chainId := range m.order {
+		seedNodes = append(seedNodes, *m.nodes[chainId])
+	}
+	return seedNodes
+}
+
+// Configs returns the configuration of every chain, running or not, sorted by chain id
+func (m *Manager) Configs() []config.P2PConfig {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	configs := make([]config.P2PConfig, 0, len(m.configs))
+	for _, cfg := range m.configs {
+		configs = append(configs, *cfg)
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].ChainId < configs[j].ChainId
+	})
+	return configs
+}
+
+/*
+Apply starts the chains added to the configuration and stops the removed ones. The chains whose listen address
+or node key changed are restarted. Changed bootstrap peers are applied live: the new ones are dialed and added to the address book.
+The other changes, i.e. the pretty name, are applied to the running chains without restarting them.
+Errors are logged and don't prevent the other chains from being updated.
+The chains stopped with Stop stay stopped, and the failed ones are retried now.
+The crawler and prober configurations are applied to every chain.
+*/
+func (m *Manager) Apply(tsConfig *config.TSConfig) Changes {
+	wanted := make(map[string]bool)
+	for _, cfg := range tsConfig.ChainConfigs {
+		wanted[cfg.ChainId] = true
+	}
+	m.mtx.Lock()
+	m.explorers = explorersConfig{tsConfig.Crawler, tsConfig.Prober}
+	for _, seedNode := range m.nodes {
+		seedNode.Crawler.SetConfig(tsConfig.Crawler)
+		seedNode.Prober.SetConfig(tsConfig.Prober)
+	}
+	var removed []string
+	for chainId := range m.configs {
+		if !wanted[chainId] {
+			removed = append(removed, chainId)
+		}
+	}
+	m.mtx.Unlock()
+
+	var changes Changes
+	for _, chainId := range removed {
+		if seedNode, stopped := m.removeChain(chainId); stopped {
+			changes.Stopped = append(changes.Stopped, seedNode)
+		}
+	}
+	for i := range tsConfig.ChainConfigs {
+		m.applyChain(copyConfig(&tsConfig.ChainConfigs[i]), &changes)
+	}
+	return changes
+}
+
+// removeChain stops a chain removed from the configuration and forgets it
+func (m *Manager) removeChain(chainId string) (SeedNodeConfig, bool) {
+	unlock := m.lockChain(chainId)
+	defer unlock()
+	seedNode, running := m.Get(chainId)
+	if running {
+		if err := m.stop(chainId); err != nil {
+			logger.Error(err.Error())
+			running = false
+		}
+	}
+	m.mtx.Lock()
+	m.cancelRetry(chainId)
+	delete(m.configs, chainId)
+	delete(m.stopped, chainId)
+	m.mtx.Unlock()
+	return seedNode, running
+}
+
+// applyChain applies the new configuration of a chain, see Apply
+func (m *Manager) applyChain(cfg *config.P2PConfig, changes *Changes) {
+	unlock := m.lockChain(cfg.ChainId)
+	defer unlock()
+	seedNode, running := m.Get(cfg.ChainId)
+	m.mtx.RLock()
+	stopped := m.stopped[cfg.ChainId]
+	m.mtx.RUnlock()
+
+	if running && (cfg.P2P.ListenAddress != seedNode.Cfg.P2P.ListenAddress || cfg.NodeKeyPath() != seedNode.Cfg.NodeKeyPath()) {
+		if err := m.stop(cfg.ChainId); err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		changes.Stopped = append(changes.Stopped, seedNode)
+		running = false
+	}
+
+	switch {
+	case !running && stopped:
+		m.mtx.Lock()
+		m.configs[cfg.ChainId] = cfg // used when it is started again
+		m.mtx.Unlock()
+	case !running:
+		if err := m.start(cfg); err != nil {
+			return // already logged, it will be retried
+		}
+		if seedNode, ok := m.Get(cfg.ChainId); ok {
+			changes.Started = append(changes.Started, seedNode)
+		}
+	default:
+		if cfg.P2P.BootstrapPeers != seedNode.Cfg.P2P.BootstrapPeers {
+			if err := dialBootstrapPeers(seedNode.Sw, cfg); err != nil {
+				logger.Error(err.Error())
+				cfg.P2P.BootstrapPeers = seedNode.Cfg.P2P.BootstrapPeers // the running ones are kept
+			} else {
+				changes.Updated = append(changes.Updated, seedNode)
+			}
+		}
+		m.setConfig(cfg)
+	}
+}
+
+// UpdateBootstrapPeers replaces the bootstrap peers of a chain. They are dialed right away if the chain is running,
+// else they are used on its next start
+func (m *Manager) UpdateBootstrapPeers(chainId string, bootstrapPeers string) error {
+	unlock := m.lockChain(chainId)
+	defer unlock()
+	m.mtx.RLock()
+	current, ok := m.configs[chainId]
+	seedNode, running := m.nodes[chainId]
+	m.mtx.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownChain, chainId)
+	}
+	cfg := copyConfig(current)
+	cfg.P2P.BootstrapPeers = bootstrapPeers
+	if running {
+		if err := dialBootstrapPeers(seedNode.Sw, cfg); err != nil {
+			return err
+		}
+	} else if _, errs := p2p.NewNetAddressStrings(tmstrings.SplitAndTrim(bootstrapPeers, ",", " ")); len(errs) > 0 {
+		return fmt.Errorf("%w for chain %s: %s", ErrInvalidPeers, chainId, errs[0].Error())
+	}
+	m.setConfig(cfg)
+	return nil
+}
+
+// setConfig replaces the config of a chain by a new one, its running seed node is replaced by a copy using it
+func (m *Manager) setConfig(cfg *config.P2PConfig) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.configs[cfg.ChainId] = cfg
+	if seedNode, ok := m.nodes[cfg.ChainId]; ok {
+		updated := *seedNode
+		updated.Cfg = cfg
+		m.nodes[cfg.ChainId] = &updated
+	}
+}
+
+// copyConfig copies the config of a chain with its p2p section, so the copy can be modified
+func copyConfig(cfg *config.P2PConfig) *config.P2PConfig {
+	copied := *cfg
+	if cfg.P2P != nil {
+		p2pConfig := *cfg.P2P
+		copied.P2P = &p2pConfig
+	}
+	return &copied
+}
+
+/*
+The pex reactor reads its seeds only on startup, so the new bootstrap peers are dialed right away
+(which also adds them to the address book) instead of restarting the chain
+*/
+func dialBootstrapPeers(sw *p2p.Switch, cfg *config.P2PConfig) error {
+	peers := tmstrings.SplitAndTrim(cfg.P2P.BootstrapPeers, ",", " ")
+	if err := sw.DialPeersAsync(peers); err != nil {
+		return fmt.Errorf("%w for chain %s: %s", ErrInvalidPeers, cfg.ChainId, err.Error())
+	}
+	logger.Info(fmt.Sprintf("Updated bootstrap peers of chain %s, dialing %d peers", cfg.PrettyName, len(peers)))
+	return nil
+}
@@ -0,0 +1,149 @@
+package seednode
+
+import (
+	"fmt"
+	tmconfig "github.com/HighStakesSwitzerland/tendermint/config"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// testConfig returns the config of a chain listening on a free local port
+func testConfig(t *testing.T, chainId string) config.P2PConfig {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	cfg := config.P2PConfig{Config: *tmconfig.DefaultConfig()}
+	cfg.ChainId = chainId
+	cfg.PrettyName = chainId
+	cfg.P2P.ListenAddress = fmt.Sprintf("tcp://127.0.0.1:%d", port)
+	return cfg
+}
+
+func newTestManager(t *testing.T, chains ...config.P2PConfig) (*Manager, *config.TSConfig) {
+	// not t.TempDir(), the address books may still be saved in the background once stopped
+	home, err := os.MkdirTemp("", "multiseed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(home) })
+	config.SetHome(home)
+	nodeKey := types.GenNodeKey()
+	tsConfig := &config.TSConfig{ChainConfigs: chains}
+	m := StartSeedNodes(tsConfig, &nodeKey, Hooks{})
+	t.Cleanup(m.StopAll)
+	return m, tsConfig
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  func(m *Manager) error
+		modify  func(tsConfig *config.TSConfig)
+		state   ChainState
+		pretty  string
+		changes [3]int // started, stopped, updated
+	}{
+		{"unchanged", nil, func(c *config.TSConfig) {}, ChainRunning, "cosmoshub-4", [3]int{0, 0, 0}},
+		{"pretty name", nil, func(c *config.TSConfig) { c.ChainConfigs[0].PrettyName = "Cosmos Hub" },
+			ChainRunning, "Cosmos Hub", [3]int{0, 0, 0}},
+		{"bootstrap peers", nil, func(c *config.TSConfig) {
+			c.ChainConfigs[0].P2P.BootstrapPeers = "ade4d8bc8cbe014af6ebdf3cb7b1e9ad36f412c0@127.0.0.1:1"
+		}, ChainRunning, "cosmoshub-4", [3]int{0, 0, 1}},
+		{"stopped by the admin", func(m *Manager) error { return m.Stop("cosmoshub-4") },
+			func(c *config.TSConfig) { c.ChainConfigs[0].PrettyName = "Cosmos Hub" }, ChainStopped, "Cosmos Hub",
+			[3]int{0, 0, 0}},
+		{"removed", nil, func(c *config.TSConfig) { c.ChainConfigs = c.ChainConfigs[1:] }, "", "", [3]int{0, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newTestManager(t, testConfig(t, "cosmoshub-4"), testConfig(t, "osmosis-1"))
+			if tt.before != nil {
+				if err := tt.before(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := m.Configs()
+
+			tsConfig := &config.TSConfig{}
+			for _, cfg := range before {
+				tsConfig.ChainConfigs = append(tsConfig.ChainConfigs, *copyConfig(&cfg))
+			}
+			tt.modify(tsConfig)
+			changes := m.Apply(tsConfig)
+
+			got := [3]int{len(changes.Started), len(changes.Stopped), len(changes.Updated)}
+			if got != tt.changes {
+				t.Errorf("Apply() started, stopped, updated = %v, want %v", got, tt.changes)
+			}
+			status, ok := m.Status("cosmoshub-4")
+			if ok != (tt.state != "") || status.State != tt.state {
+				t.Errorf("state = %q, want %q", status.State, tt.state)
+			}
+			if got := m.prettyName("cosmoshub-4"); got != tt.pretty {
+				t.Errorf("pretty name = %q, want %q", got, tt.pretty)
+			}
+			if seedNode, ok := m.Get("cosmoshub-4"); ok && seedNode.Cfg.PrettyName != tt.pretty {
+				t.Errorf("pretty name of the running chain = %q, want %q", seedNode.Cfg.PrettyName, tt.pretty)
+			}
+			if before[0].P2P.BootstrapPeers != "" {
+				t.Error("Apply() modified the previous config of the chain")
+			}
+		})
+	}
+}
+
+func TestStoppedChainStartedAgain(t *testing.T) {
+	m, tsConfig := newTestManager(t, testConfig(t, "cosmoshub-4"))
+	if err := m.Stop("cosmoshub-4"); err != nil {
+		t.Fatal(err)
+	}
+	m.Apply(tsConfig)
+	if status, _ := m.Status("cosmoshub-4"); status.State != ChainStopped {
+		t.Fatalf("state after Apply() = %s, want stopped", status.State)
+	}
+	if err := m.StartChain("cosmoshub-4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop("cosmoshub-4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.StartChain("cosmoshub-4"); err != nil {
+		t.Fatal(err)
+	}
+	m.Apply(tsConfig)
+	if status, _ := m.Status("cosmoshub-4"); status.State != ChainRunning {
+		t.Errorf("state after StartChain() and Apply() = %s, want running", status.State)
+	}
+}
+
+func TestChainLockDoesNotBlockOthers(t *testing.T) {
+	m, _ := newTestManager(t, testConfig(t, "cosmoshub-4"), testConfig(t, "osmosis-1"))
+	unlock := m.lockChain("cosmoshub-4") // like a chain taking long to start or stop
+	defer unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.List()
+		m.Configs()
+		_, _ = m.Status("cosmoshub-4")
+		_, _ = m.Health("cosmoshub-4", time.Minute)
+		_ = m.Restart("osmosis-1")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a chain being started or stopped blocks the other chains")
+	}
+	if status, _ := m.Status("osmosis-1"); status.State != ChainRunning {
+		t.Errorf("osmosis-1 state after Restart() = %s, want running", status.State)
+	}
+}
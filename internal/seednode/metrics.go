@@ -0,0 +1,159 @@
+package seednode
+
+import (
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	tmp2p "github.com/HighStakesSwitzerland/tendermint/proto/tendermint/p2p"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	MetricsNamespace = "multiseed"
+
+	// bucket types of pex.KnownAddress
+	bucketTypeNew = 0x01
+	bucketTypeOld = 0x02
+)
+
+var (
+	ChainLabels = []string{"chain_id", "pretty_name"}
+
+	pexRequestsServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "pex",
+		Name:      "requests_served_total",
+		Help:      "Number of PEX address requests received from peers.",
+	}, ChainLabels)
+	dialSuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "p2p",
+		Name:      "dial_successes_total",
+		Help:      "Number of outbound peers successfully dialed.",
+	}, ChainLabels)
+	dialFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "p2p",
+		Name:      "dial_failures_total",
+		Help:      "Number of failed dial attempts recorded in the address book.",
+	}, ChainLabels)
+	inboundConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "p2p",
+		Name:      "inbound_connections_total",
+		Help:      "Number of inbound peers accepted.",
+	}, ChainLabels)
+	crawls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "crawler",
+		Name:      "crawls_total",
+		Help:      "Number of addresses crawled, by result: responded, no_response or unreachable.",
+	}, append(ChainLabels, "result"))
+	crawledAddresses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "crawler",
+		Name:      "addresses_received_total",
+		Help:      "Number of addresses received from the crawled peers.",
+	}, ChainLabels)
+	probes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "prober",
+		Name:      "probes_total",
+		Help:      "Number of addresses probed, by result: reachable or unreachable.",
+	}, append(ChainLabels, "result"))
+)
+
+func init() {
+	prometheus.MustRegister(pexRequestsServed, dialSuccesses, dialFailures, inboundConnections, crawls, crawledAddresses, probes)
+}
+
+/*
+DeleteMetrics removes the series of a stopped chain, so they are not exported anymore and a chain removed from the
+config doesn't stay in /metrics. They are deleted with the labels the chain started with, as the pretty name may
+have been reloaded since
+*/
+func (s SeedNodeConfig) DeleteMetrics() {
+	if len(s.labels) != len(ChainLabels) {
+		return
+	}
+	for _, vec := range []*prometheus.CounterVec{pexRequestsServed, dialSuccesses, dialFailures, inboundConnections,
+		crawledAddresses} {
+		vec.DeleteLabelValues(s.labels...)
+	}
+	for _, result := range []string{crawlResponded, crawlNoResponse, crawlFailed} {
+		crawls.DeleteLabelValues(s.labels[0], s.labels[1], result)
+	}
+	for _, result := range []string{probeReachable, probeUnreachable} {
+		probes.DeleteLabelValues(s.labels[0], s.labels[1], result)
+	}
+}
+
+// meteredPexReactor counts the PEX requests and the peers added to the switch, and records them in the chain health
+// along with their NodeInfo. The PEX responses and the peers dialed are passed to the crawler
+type meteredPexReactor struct {
+	*pex.Reactor
+	labels    []string
+	health    *Health
+	crawler   *Crawler
+	nodeInfos *NodeInfos
+}
+
+func (r *meteredPexReactor) AddPeer(peer p2p.Peer) {
+	if peer.IsOutbound() {
+		dialSuccesses.WithLabelValues(r.labels...).Inc()
+		r.crawler.dialed(peer.ID())
+	} else {
+		inboundConnections.WithLabelValues(r.labels...).Inc()
+	}
+	r.health.peerSeen()
+	r.nodeInfos.Record(peer.NodeInfo())
+	r.Reactor.AddPeer(peer)
+}
+
+func (r *meteredPexReactor) RemovePeer(peer p2p.Peer, reason interface{}) {
+	r.health.peerSeen() // the peer was connected until now
+	r.Reactor.RemovePeer(peer, reason)
+}
+
+func (r *meteredPexReactor) Receive(chID byte, src p2p.Peer, msgBytes []byte) {
+	msg := &tmp2p.PexMessage{}
+	if err := msg.Unmarshal(msgBytes); err == nil {
+		switch msg.Sum.(type) {
+		case *tmp2p.PexMessage_PexRequest:
+			pexRequestsServed.WithLabelValues(r.labels...).Inc()
+			r.health.pexExchanged()
+		case *tmp2p.PexMessage_PexResponse:
+			r.health.pexExchanged()
+			r.crawler.pexResponse(src.ID(), len(msg.GetPexResponse().Addresses))
+		}
+	}
+	r.Reactor.Receive(chID, src, msgBytes)
+}
+
+// meteredAddrBook counts the failed dial attempts, which the pex reactor reports to the address book, and passes them
+// to the crawler
+type meteredAddrBook struct {
+	pex.AddrBook
+	labels  []string
+	crawler *Crawler
+}
+
+func (a *meteredAddrBook) MarkAttempt(addr *p2p.NetAddress) {
+	dialFailures.WithLabelValues(a.labels...).Inc()
+	if a.crawler != nil {
+		a.crawler.dialed(addr.ID)
+	}
+	a.AddrBook.MarkAttempt(addr)
+}
+
+// AddrBookSize returns the number of addresses in the new and old buckets of the address book
+func AddrBookSize(addrBook pex.AddrBook) (newBucket int, oldBucket int) {
+	for _, address := range addrBook.GetAddrbookContent() {
+		switch address.BucketType {
+		case bucketTypeNew:
+			newBucket++
+		case bucketTypeOld:
+			oldBucket++
+		}
+	}
+	return newBucket, oldBucket
+}
@@ -0,0 +1,44 @@
+package seednode
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"testing"
+)
+
+func TestDeleteMetrics(t *testing.T) {
+	stopped := SeedNodeConfig{labels: []string{"stopped-1", "Stopped"}}
+	running := SeedNodeConfig{labels: []string{"running-1", "Running"}}
+	vecs := map[string]*prometheus.CounterVec{"pex requests": pexRequestsServed, "dial successes": dialSuccesses,
+		"dial failures": dialFailures, "inbound connections": inboundConnections, "crawled addresses": crawledAddresses}
+	for _, seedNode := range []SeedNodeConfig{stopped, running} {
+		for _, vec := range vecs {
+			vec.WithLabelValues(seedNode.labels...).Inc()
+		}
+		crawls.WithLabelValues(seedNode.labels[0], seedNode.labels[1], crawlResponded).Inc()
+		probes.WithLabelValues(seedNode.labels[0], seedNode.labels[1], probeUnreachable).Inc()
+	}
+
+	stopped.DeleteMetrics()
+	// DeleteLabelValues reports whether the series still existed
+	tests := []struct {
+		seedNode SeedNodeConfig
+		exists   bool
+	}{
+		{stopped, false},
+		{running, true},
+	}
+	for _, tt := range tests {
+		labels := tt.seedNode.labels
+		for name, vec := range vecs {
+			if exists := vec.DeleteLabelValues(labels...); exists != tt.exists {
+				t.Errorf("%s of %s exists = %v, want %v", name, labels[0], exists, tt.exists)
+			}
+		}
+		if exists := crawls.DeleteLabelValues(labels[0], labels[1], crawlResponded); exists != tt.exists {
+			t.Errorf("crawls of %s exists = %v, want %v", labels[0], exists, tt.exists)
+		}
+		if exists := probes.DeleteLabelValues(labels[0], labels[1], probeUnreachable); exists != tt.exists {
+			t.Errorf("probes of %s exists = %v, want %v", labels[0], exists, tt.exists)
+		}
+	}
+}
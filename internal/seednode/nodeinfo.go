@@ -0,0 +1,226 @@
+package seednode
+
+import (
+	"encoding/json"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	nodeInfosTTL = 30 * 24 * time.Hour // node infos not reported again since are dropped
+	// VersionsWindow is how recently a peer must have reported its NodeInfo to be counted in the versions distribution.
+	// The prober handshakes again with the reachable peers every 6 hours by default
+	VersionsWindow = 24 * time.Hour
+)
+
+// ProtocolVersion is the p2p, block and app protocol versions of a node
+type ProtocolVersion struct {
+	P2P   uint64 `json:"p2p"`
+	Block uint64 `json:"block"`
+	App   uint64 `json:"app"`
+}
+
+// PeerNodeInfo is what a peer tells about itself during the handshake
+type PeerNodeInfo struct {
+	Moniker         string          `json:"moniker"`
+	Network         string          `json:"network"`
+	Version         string          `json:"version"`
+	ProtocolVersion ProtocolVersion `json:"protocol_version"`
+	Channels        string          `json:"channels"` // hex encoded channel ids
+	TxIndex         string          `json:"tx_index"`
+	RPCAddress      string          `json:"rpc_address"`
+	ReportedAt      time.Time       `json:"reported_at"`
+}
+
+func newPeerNodeInfo(nodeInfo types.NodeInfo) PeerNodeInfo {
+	return PeerNodeInfo{
+		Moniker: nodeInfo.Moniker,
+		Network: nodeInfo.Network,
+		Version: nodeInfo.Version,
+		ProtocolVersion: ProtocolVersion{
+			P2P:   nodeInfo.ProtocolVersion.P2P,
+			Block: nodeInfo.ProtocolVersion.Block,
+			App:   nodeInfo.ProtocolVersion.App,
+		},
+		Channels:   nodeInfo.Channels.String(),
+		TxIndex:    nodeInfo.Other.TxIndex,
+		RPCAddress: nodeInfo.Other.RPCAddress,
+		ReportedAt: time.Now(),
+	}
+}
+
+/*
+NodeInfos keeps the last NodeInfo reported by every peer of a chain, from the handshakes of the switch and of the
+prober. The seed node disconnects its peers quickly, so the switch alone only knows the few peers connected right now
+*/
+type NodeInfos struct {
+	mtx      sync.Mutex
+	chainId  string
+	filePath string
+	infos    map[types.NodeID]PeerNodeInfo
+	dirty    bool
+}
+
+func newNodeInfos(chainId string) *NodeInfos {
+	n, err := ReadNodeInfos(chainId)
+	if err != nil {
+		logger.Error("Could not load the node infos, starting with none: " + err.Error())
+	}
+	return n
+}
+
+// ReadNodeInfos reads the saved node infos of a chain, without starting it
+func ReadNodeInfos(chainId string) (*NodeInfos, error) {
+	n := &NodeInfos{chainId: chainId, filePath: config.NodeInfosPath(chainId), infos: make(map[types.NodeID]PeerNodeInfo)}
+	return n, n.load()
+}
+
+func (n *NodeInfos) load() error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	content, err := os.ReadFile(n.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	infos := make(map[types.NodeID]PeerNodeInfo)
+	if err := json.Unmarshal(content, &infos); err != nil {
+		return err
+	}
+	for id, info := range infos {
+		if info.Network == n.chainId { // saved before the network was checked
+			n.infos[id] = info
+		}
+	}
+	return nil
+}
+
+// Record stores the NodeInfo reported by a peer, replacing the previous one.
+// The peers of another network are ignored, they tell nothing about this chain
+func (n *NodeInfos) Record(nodeInfo types.NodeInfo) bool {
+	if nodeInfo.Network != n.chainId {
+		return false
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.infos[nodeInfo.NodeID] = newPeerNodeInfo(nodeInfo)
+	n.dirty = true
+	return true
+}
+
+// Get returns the last NodeInfo reported by a peer
+func (n *NodeInfos) Get(id types.NodeID) (PeerNodeInfo, bool) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	info, ok := n.infos[id]
+	return info, ok
+}
+
+// All returns a copy of the last NodeInfo of every peer, keyed by node ID
+func (n *NodeInfos) All() map[types.NodeID]PeerNodeInfo {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	infos := make(map[types.NodeID]PeerNodeInfo, len(n.infos))
+	for id, info := range n.infos {
+		infos[id] = info
+	}
+	return infos
+}
+
+// VersionGroup counts the peers running the same software and protocol versions
+type VersionGroup struct {
+	Version      string `json:"version"`
+	BlockVersion uint64 `json:"block_version"`
+	AppVersion   uint64 `json:"app_version"`
+	Peers        int    `json:"peers"`
+}
+
+// VersionGroups groups the peers which reported their NodeInfo since the given time by versions, most common first
+func (n *NodeInfos) VersionGroups(since time.Time) []VersionGroup {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	counts := make(map[VersionGroup]int)
+	for _, info := range n.infos {
+		if info.ReportedAt.Before(since) || info.Network != n.chainId {
+			continue
+		}
+		counts[VersionGroup{Version: info.Version, BlockVersion: info.ProtocolVersion.Block, AppVersion: info.ProtocolVersion.App}]++
+	}
+	groups := make([]VersionGroup, 0, len(counts))
+	for group, count := range counts {
+		group.Peers = count
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Peers != groups[j].Peers {
+			return groups[i].Peers > groups[j].Peers
+		}
+		return groups[i].Version < groups[j].Version ||
+			groups[i].Version == groups[j].Version && (groups[i].BlockVersion < groups[j].BlockVersion ||
+				groups[i].BlockVersion == groups[j].BlockVersion && groups[i].AppVersion < groups[j].AppVersion)
+	})
+	return groups
+}
+
+// VersionCounts is the number of peers per software version, block protocol version and app protocol version
+type VersionCounts struct {
+	Peers         int            `json:"peers"`
+	Versions      map[string]int `json:"versions"`
+	BlockVersions map[uint64]int `json:"block_versions"`
+	AppVersions   map[uint64]int `json:"app_versions"`
+}
+
+// CountVersions sums the version groups by software, block and app version
+func CountVersions(groups []VersionGroup) VersionCounts {
+	counts := VersionCounts{
+		Versions:      make(map[string]int),
+		BlockVersions: make(map[uint64]int),
+		AppVersions:   make(map[uint64]int),
+	}
+	for _, group := range groups {
+		counts.Peers += group.Peers
+		counts.Versions[group.Version] += group.Peers
+		counts.BlockVersions[group.BlockVersion] += group.Peers
+		counts.AppVersions[group.AppVersion] += group.Peers
+	}
+	return counts
+}
+
+// Save writes the node infos to disk if they changed since the last save
+func (n *NodeInfos) Save() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	if !n.dirty {
+		return
+	}
+	for id, info := range n.infos {
+		if time.Since(info.ReportedAt) > nodeInfosTTL {
+			delete(n.infos, id)
+		}
+	}
+	if err := writeJsonFile(n.filePath, n.infos); err != nil {
+		logger.Error("Failed to save the node infos: " + err.Error())
+		return
+	}
+	n.dirty = false
+}
+
+// writeJsonFile writes to a temp file first, so a crash never leaves a truncated file
+func writeJsonFile(filePath string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmpFile := filePath + ".tmp"
+	if err := os.WriteFile(tmpFile, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filePath)
+}
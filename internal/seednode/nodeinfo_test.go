@@ -0,0 +1,128 @@
+package seednode
+
+import (
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNodeInfosRecord(t *testing.T) {
+	config.SetHome(t.TempDir())
+
+	tests := []struct {
+		name    string
+		network string
+		want    bool
+	}{
+		{"same chain", "cosmoshub-4", true},
+		{"other chain", "osmosis-1", false},
+		{"testnet", "theta-testnet-001", false},
+		{"empty network", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeInfos := newNodeInfos("cosmoshub-4")
+			nodeInfo := types.NodeInfo{NodeID: "0a57cb53ba59c46fc4b692527a38a87c78d84028", Network: tt.network, Version: "v0.34.21"}
+			if recorded := nodeInfos.Record(nodeInfo); recorded != tt.want {
+				t.Errorf("Record() = %v, want %v", recorded, tt.want)
+			}
+			if _, ok := nodeInfos.Get(nodeInfo.NodeID); ok != tt.want {
+				t.Errorf("Get() found = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeInfosSaveAndReload(t *testing.T) {
+	config.SetHome(t.TempDir())
+
+	nodeInfos := newNodeInfos("cosmoshub-4")
+	nodeInfos.Record(types.NodeInfo{NodeID: "0a57cb53ba59c46fc4b692527a38a87c78d84028", Network: "cosmoshub-4", Version: "v0.34.21"})
+	nodeInfos.Save()
+
+	reloaded, err := ReadNodeInfos("cosmoshub-4")
+	if err != nil {
+		t.Fatalf("ReadNodeInfos() error = %v", err)
+	}
+	info, ok := reloaded.Get("0a57cb53ba59c46fc4b692527a38a87c78d84028")
+	if !ok || info.Version != "v0.34.21" {
+		t.Errorf("reloaded node info = %+v, %v, want version v0.34.21", info, ok)
+	}
+}
+
+func TestVersionGroups(t *testing.T) {
+	now := time.Now()
+	info := func(network, version string, block, app uint64, reportedAt time.Time) PeerNodeInfo {
+		return PeerNodeInfo{Network: network, Version: version, ProtocolVersion: ProtocolVersion{Block: block, App: app},
+			ReportedAt: reportedAt}
+	}
+
+	tests := []struct {
+		name  string
+		infos []PeerNodeInfo
+		want  []VersionGroup
+	}{
+		{"no peers", nil, []VersionGroup{}},
+		{
+			"grouped by versions, most common first",
+			[]PeerNodeInfo{
+				info("cosmoshub-4", "v0.34.20", 11, 0, now),
+				info("cosmoshub-4", "v0.34.21", 11, 0, now),
+				info("cosmoshub-4", "v0.34.21", 11, 0, now),
+				info("cosmoshub-4", "v0.34.21", 11, 1, now),
+			},
+			[]VersionGroup{
+				{Version: "v0.34.21", BlockVersion: 11, AppVersion: 0, Peers: 2},
+				{Version: "v0.34.20", BlockVersion: 11, AppVersion: 0, Peers: 1},
+				{Version: "v0.34.21", BlockVersion: 11, AppVersion: 1, Peers: 1},
+			},
+		},
+		{
+			"old reports are ignored",
+			[]PeerNodeInfo{
+				info("cosmoshub-4", "v0.34.21", 11, 0, now),
+				info("cosmoshub-4", "v0.34.19", 11, 0, now.Add(-2*VersionsWindow)),
+			},
+			[]VersionGroup{{Version: "v0.34.21", BlockVersion: 11, AppVersion: 0, Peers: 1}},
+		},
+		{
+			"other networks are ignored",
+			[]PeerNodeInfo{
+				info("cosmoshub-4", "v0.34.21", 11, 0, now),
+				info("theta-testnet-001", "v0.37.0", 11, 0, now),
+			},
+			[]VersionGroup{{Version: "v0.34.21", BlockVersion: 11, AppVersion: 0, Peers: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeInfos := &NodeInfos{chainId: "cosmoshub-4", infos: make(map[types.NodeID]PeerNodeInfo)}
+			for i, info := range tt.infos {
+				nodeInfos.infos[types.NodeID(fmt.Sprintf("%040d", i))] = info
+			}
+			if got := nodeInfos.VersionGroups(now.Add(-VersionsWindow)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("VersionGroups() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountVersions(t *testing.T) {
+	counts := CountVersions([]VersionGroup{
+		{Version: "v0.34.21", BlockVersion: 11, AppVersion: 0, Peers: 2},
+		{Version: "v0.34.20", BlockVersion: 11, AppVersion: 0, Peers: 1},
+		{Version: "v0.34.21", BlockVersion: 11, AppVersion: 1, Peers: 1},
+	})
+	want := VersionCounts{
+		Peers:         4,
+		Versions:      map[string]int{"v0.34.21": 3, "v0.34.20": 1},
+		BlockVersions: map[uint64]int{11: 4},
+		AppVersions:   map[uint64]int{0: 3, 1: 1},
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("CountVersions() = %+v, want %+v", counts, want)
+	}
+}
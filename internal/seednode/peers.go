@@ -1,9 +1,13 @@
 package seednode
 
 import (
+	"encoding/json"
 	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
 	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
 	"net"
+	"os"
 	"time"
 )
 
@@ -13,6 +17,7 @@ type Peer struct {
 	Port     uint16
 	NodeId   types.NodeID
 	LastSeen time.Time
+	NodeInfo *PeerNodeInfo // nil for the address book entries
 }
 
 func ToSeednodePeers(peers []p2p.Peer) []*Peer {
@@ -25,12 +30,14 @@ func ToSeednodePeers(peers []p2p.Peer) []*Peer {
 func p2pPeersToPeerList(list []p2p.Peer) []*Peer {
 	var _peers []*Peer
 	for _, p := range list {
+		nodeInfo := newPeerNodeInfo(p.NodeInfo())
 		_peers = append(_peers, &Peer{
 			Moniker:  p.NodeInfo().Moniker,
 			LastSeen: time.Now().Add(-p.Status().Duration),
 			IP:       p.SocketAddr().IP,
 			Port:     p.SocketAddr().Port,
 			NodeId:   p.NodeInfo().ID(),
+			NodeInfo: &nodeInfo,
 		})
 	}
 	return _peers
@@ -41,4 +48,48 @@ func SaveLastSeenAttrInAddrbook(config SeedNodeConfig) {
 		config.Sw.MarkPeerAsGood(peer)
 	}
 	config.AddrBook.Save()
+	config.NodeInfos.Save()
+}
+
+// ReadAddrBookFile reads the saved address book of a chain, without starting it
+func ReadAddrBookFile(chainId string) ([]*pex.KnownAddress, error) {
+	content, err := os.ReadFile(config.AddrBookPath(chainId))
+	if err != nil {
+		return nil, err
+	}
+	var addrBook struct {
+		Addrs []*pex.KnownAddress `json:"addrs"`
+	}
+	if err := json.Unmarshal(content, &addrBook); err != nil {
+		return nil, err
+	}
+	return addrBook.Addrs, nil
+}
+
+// ExportedPeer is an address book entry, as exported for node operators
+type ExportedPeer struct {
+	Address     string    `json:"address"`
+	Moniker     string    `json:"moniker,omitempty"`
+	LastSuccess time.Time `json:"last_success"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	As          string    `json:"as,omitempty"`
+}
+
+func ExportPeers(addresses []*pex.KnownAddress) []ExportedPeer {
+	peers := make([]ExportedPeer, 0, len(addresses))
+	for _, address := range addresses {
+		if address.Addr == nil {
+			continue
+		}
+		peers = append(peers, ExportedPeer{
+			Address:     address.Addr.String(),
+			Moniker:     address.Moniker,
+			LastSuccess: address.LastSuccess,
+			Country:     address.Country,
+			City:        address.City,
+			As:          address.As,
+		})
+	}
+	return peers
 }
@@ -0,0 +1,339 @@
+package seednode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/crypto"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
+	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	mrand "math/rand"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeInterval    = 60 * time.Second
+	defaultProbeBatchSize   = 50
+	defaultProbeConcurrency = 10
+	defaultProbeTimeout     = 10 * time.Second
+	defaultReprobeAfter     = 6 * time.Hour
+	probeResultsTTL         = 30 * 24 * time.Hour // results of the addresses not probed since are dropped
+)
+
+// probe results, used as metrics label
+const (
+	probeReachable   = "reachable"
+	probeUnreachable = "unreachable"
+)
+
+// ProbeResult is the last reachability probe of an address
+type ProbeResult struct {
+	IP        net.IP        `json:"ip"`
+	Port      uint16        `json:"port"`
+	Reachable bool          `json:"reachable"` // the handshake completed with the expected node, on this chain
+	ProbedAt  time.Time     `json:"probed_at"`
+	Latency   time.Duration `json:"latency"` // from the dial to the end of the handshake
+	Error     string        `json:"error,omitempty"`
+	NodeInfo  *PeerNodeInfo `json:"node_info,omitempty"`
+}
+
+// ProberStats summarizes the last probe of every address of a chain
+type ProberStats struct {
+	LastRound   *time.Time `json:"last_round,omitempty"`
+	Probed      int        `json:"probed"`
+	Reachable   int        `json:"reachable"`
+	Unreachable int        `json:"unreachable"`
+}
+
+/*
+Prober checks which addresses of the address book accept inbound connections. On every round, it connects to the
+addresses which were not probed for the longest time and completes a tendermint handshake, without adding them to
+the switch. The results are kept per node ID and saved in the home directory, so the peers behind a NAT or a firewall
+can be told apart from the public ones
+*/
+type Prober struct {
+	mtx       sync.Mutex
+	cfg       config.ProberConfig
+	chainId   string
+	sw        *p2p.Switch
+	transport *p2p.MConnTransport
+	addrBook  pex.AddrBook
+	privKey   crypto.PrivKey
+	nodeInfos *NodeInfos
+	labels    []string
+	filePath  string
+	results   map[types.NodeID]ProbeResult
+	lastRound *time.Time
+	dirty     bool
+	quit      chan struct{}
+	stopOnce  sync.Once
+}
+
+func newProber(cfg config.ProberConfig, chainId string, sw *p2p.Switch, transport *p2p.MConnTransport,
+	addrBook pex.AddrBook, privKey crypto.PrivKey, nodeInfos *NodeInfos, labels []string) *Prober {
+	p := &Prober{
+		cfg:       cfg,
+		chainId:   chainId,
+		sw:        sw,
+		transport: transport,
+		addrBook:  addrBook,
+		privKey:   privKey,
+		nodeInfos: nodeInfos,
+		labels:    labels,
+		filePath:  config.ProbesPath(chainId),
+		results:   make(map[types.NodeID]ProbeResult),
+		quit:      make(chan struct{}),
+	}
+	if err := p.load(); err != nil {
+		logger.Error(fmt.Sprintf("Could not load the probes of chain %s, starting with none: %s", chainId, err.Error()))
+	}
+	return p
+}
+
+// Start runs the rounds in the background until Stop is called. A disabled prober only waits to be enabled
+func (p *Prober) Start() {
+	go func() {
+		for {
+			timer := time.NewTimer(p.config().Interval)
+			select {
+			case <-timer.C:
+				if p.config().Enabled {
+					p.round()
+				}
+			case <-p.quit:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the rounds and saves the results
+func (p *Prober) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.quit)
+	})
+	p.Save()
+}
+
+// SetConfig applies a new configuration from the next round
+func (p *Prober) SetConfig(cfg config.ProberConfig) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.cfg = cfg
+}
+
+// config returns the configuration with the defaults applied
+func (p *Prober) config() config.ProberConfig {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	cfg := p.cfg
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultProbeInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultProbeBatchSize
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultProbeConcurrency
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProbeTimeout
+	}
+	if cfg.ReprobeAfter <= 0 {
+		cfg.ReprobeAfter = defaultReprobeAfter
+	}
+	return cfg
+}
+
+// Results returns a copy of the last probe of every address, keyed by node ID
+func (p *Prober) Results() map[types.NodeID]ProbeResult {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	results := make(map[types.NodeID]ProbeResult, len(p.results))
+	for id, result := range p.results {
+		results[id] = result
+	}
+	return results
+}
+
+// Stats counts the reachable and unreachable addresses, from their last probe
+func (p *Prober) Stats() ProberStats {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	stats := ProberStats{Probed: len(p.results)}
+	if p.lastRound != nil {
+		lastRound := *p.lastRound
+		stats.LastRound = &lastRound
+	}
+	for _, result := range p.results {
+		if result.Reachable {
+			stats.Reachable++
+		} else {
+			stats.Unreachable++
+		}
+	}
+	return stats
+}
+
+func (p *Prober) round() {
+	cfg := p.config()
+	addresses := p.selectAddresses(cfg)
+	if len(addresses) == 0 {
+		return
+	}
+
+	var reachable int
+	var countMtx sync.Mutex
+	forEachAddress(addresses, cfg.Concurrency, p.quit, func(addr *p2p.NetAddress) {
+		result := p.probe(addr, cfg.Timeout)
+		select {
+		case <-p.quit:
+			return // the transport closed under the probe, it tells nothing about the address
+		default:
+		}
+		p.mtx.Lock()
+		p.results[addr.ID] = result
+		p.dirty = true
+		p.mtx.Unlock()
+		if result.Reachable {
+			countMtx.Lock()
+			reachable++
+			countMtx.Unlock()
+			probes.WithLabelValues(p.labels[0], p.labels[1], probeReachable).Inc()
+		} else {
+			probes.WithLabelValues(p.labels[0], p.labels[1], probeUnreachable).Inc()
+		}
+	})
+	now := time.Now()
+	p.mtx.Lock()
+	p.lastRound = &now
+	p.mtx.Unlock()
+	p.Save()
+	logger.Debug(fmt.Sprintf("Probed %d addresses of chain %s, %d reachable", len(addresses), p.labels[0], reachable))
+}
+
+// selectAddresses returns the addresses of the address book which were not probed for the longest time
+func (p *Prober) selectAddresses(cfg config.ProberConfig) []*p2p.NetAddress {
+	content := p.addrBook.GetAddrbookContent()
+	mrand.Shuffle(len(content), func(i, j int) {
+		content[i], content[j] = content[j], content[i]
+	})
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	candidates := make([]*p2p.NetAddress, 0)
+	for _, address := range content {
+		if address.Addr == nil || p.addrBook.IsBanned(address.Addr) {
+			continue
+		}
+		result, ok := p.results[address.Addr.ID]
+		if ok && result.IP.Equal(address.Addr.IP) && now.Sub(result.ProbedAt) < cfg.ReprobeAfter {
+			continue
+		}
+		candidates = append(candidates, address.Addr)
+	}
+	// never probed first, as their zero time is the oldest
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return p.results[candidates[i].ID].ProbedAt.Before(p.results[candidates[j].ID].ProbedAt)
+	})
+	if len(candidates) > cfg.BatchSize {
+		candidates = candidates[:cfg.BatchSize]
+	}
+	return candidates
+}
+
+// probe connects to an address and completes a handshake, then closes the connection
+func (p *Prober) probe(addr *p2p.NetAddress, timeout time.Duration) ProbeResult {
+	result := ProbeResult{IP: addr.IP, Port: addr.Port, ProbedAt: time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := p.transport.Dial(ctx, p2p.Endpoint{Protocol: p2p.MConnProtocol, IP: addr.IP, Port: addr.Port})
+	if err != nil {
+		result.Error = "dial failed: " + err.Error()
+		return result
+	}
+	defer conn.Close()
+	peerInfo, _, err := conn.Handshake(ctx, timeout, p.sw.NodeInfo(), p.privKey)
+	result.Latency = time.Since(result.ProbedAt)
+	if err != nil {
+		result.Error = "handshake failed: " + err.Error()
+		return result
+	}
+	nodeInfo := newPeerNodeInfo(peerInfo)
+	result.NodeInfo = &nodeInfo
+	if peerInfo.NodeID != addr.ID {
+		result.Error = fmt.Sprintf("expected node %s, got %s", addr.ID, peerInfo.NodeID)
+		return result
+	}
+	if peerInfo.Network != p.chainId {
+		// i.e. a testnet node now running on an address of this chain
+		result.Error = fmt.Sprintf("expected network %s, got %s", p.chainId, peerInfo.Network)
+		return result
+	}
+	result.Reachable = true
+	p.nodeInfos.Record(peerInfo)
+	return result
+}
+
+func (p *Prober) load() error {
+	results, err := ReadProbes(p.chainId)
+	if err != nil {
+		return err
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.results = results
+	return nil
+}
+
+// ReadProbes reads the saved probes of a chain, without starting it
+func ReadProbes(chainId string) (map[types.NodeID]ProbeResult, error) {
+	results := make(map[types.NodeID]ProbeResult)
+	content, err := os.ReadFile(config.ProbesPath(chainId))
+	if os.IsNotExist(err) {
+		return results, nil
+	} else if err != nil {
+		return results, err
+	}
+	if err := json.Unmarshal(content, &results); err != nil {
+		return make(map[types.NodeID]ProbeResult), err
+	}
+	for id, result := range results {
+		// saved before the network was checked
+		if result.Reachable && result.NodeInfo != nil && result.NodeInfo.Network != chainId {
+			result.Reachable = false
+			result.Error = fmt.Sprintf("expected network %s, got %s", chainId, result.NodeInfo.Network)
+			results[id] = result
+		}
+	}
+	return results, nil
+}
+
+// Save writes the results to disk if they changed since the last save
+func (p *Prober) Save() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if !p.dirty {
+		return
+	}
+	for id, result := range p.results {
+		if time.Since(result.ProbedAt) > probeResultsTTL {
+			delete(p.results, id)
+		}
+	}
+	if err := writeJsonFile(p.filePath, p.results); err != nil {
+		logger.Error("Failed to save the probes: " + err.Error())
+		return
+	}
+	p.dirty = false
+}
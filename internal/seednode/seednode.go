@@ -1,44 +1,59 @@
 package seednode
 
 import (
+	"errors"
 	"fmt"
 	"github.com/HighStakesSwitzerland/tendermint/internals/p2p"
 	"github.com/HighStakesSwitzerland/tendermint/internals/p2p/pex"
 	"github.com/HighStakesSwitzerland/tendermint/libs/log"
-	tmos "github.com/HighStakesSwitzerland/tendermint/libs/os"
 	tmstrings "github.com/HighStakesSwitzerland/tendermint/libs/strings"
 	"github.com/HighStakesSwitzerland/tendermint/types"
 	"github.com/HighStakesSwitzerland/tendermint/version"
 	"github.com/highstakesswitzerland/multiseed/internal/config"
-	"github.com/mitchellh/go-homedir"
-	"path/filepath"
 	"time"
 )
 
 var (
 	logger     = log.MustNewDefaultLogger("text", "info", false)
 	noOpLogger = log.NewNopLogger()
+	p2pLogger  = func(chainId string) log.Logger { return noOpLogger }
 )
 
+// SetLogger replaces the default logger of the package, built from the config once it is loaded.
+// chainLogger returns the logger of the switch, transport and pex reactor of a chain
+func SetLogger(l log.Logger, chainLogger func(chainId string) log.Logger) {
+	logger = l
+	p2pLogger = chainLogger
+}
+
 type SeedNodeConfig struct {
-	Sw       *p2p.Switch
-	Cfg      *config.P2PConfig
-	AddrBook pex.AddrBook
+	Sw         *p2p.Switch
+	Cfg        *config.P2PConfig
+	AddrBook   pex.AddrBook
+	PexReactor *pex.Reactor
+	Transport  *p2p.MConnTransport
+	Health     *Health
+	Crawler    *Crawler
+	Prober     *Prober
+	NodeInfos  *NodeInfos
+	labels     []string // metrics labels, as of the start of the chain
 }
 
-func StartSeedNodes(seedConfig *config.TSConfig, nodeKey *types.NodeKey) []SeedNodeConfig {
-	var seedNodes []SeedNodeConfig
+// StartSeedNodes starts every chain of the config. A chain which fails to start is retried in the background
+func StartSeedNodes(seedConfig *config.TSConfig, nodeKey *types.NodeKey, hooks Hooks) *Manager {
+	manager := NewManager(nodeKey, seedConfig, hooks)
 
 	for i := 0; i < len(seedConfig.ChainConfigs); i++ {
-		if sw, addrBook := startSeedNode(&seedConfig.ChainConfigs[i], nodeKey); sw != nil {
-			seedNodes = append(seedNodes, SeedNodeConfig{sw, &seedConfig.ChainConfigs[i], addrBook})
-		}
+		_ = manager.Start(&seedConfig.ChainConfigs[i])
 	}
-	return seedNodes
+	return manager
 }
 
-func startSeedNode(cfg *config.P2PConfig, nodeKey *types.NodeKey) (*p2p.Switch, pex.AddrBook) {
-	logger.Info(fmt.Sprintf("Starting Seed Node for chain %s [%s]", cfg.PrettyName, cfg.ChainId))
+func startSeedNode(cfg *config.P2PConfig, nodeKey *types.NodeKey, explorers explorersConfig) (*SeedNodeConfig, error) {
+	logger.Info(fmt.Sprintf("Starting Seed Node for chain %s [%s]", cfg.PrettyName, cfg.ChainId), "nodeId", nodeKey.ID)
+	if cfg.P2P == nil {
+		return nil, errors.New("missing p2p config")
+	}
 
 	nodeInfo := types.NodeInfo{
 		ProtocolVersion: types.ProtocolVersion{
@@ -54,19 +69,21 @@ func startSeedNode(cfg *config.P2PConfig, nodeKey *types.NodeKey) (*p2p.Switch,
 		Channels:   []byte{byte(0x00)},
 	}
 
-	// set conn settings
-	cfg.P2P.RecvRate = 512000
-	cfg.P2P.SendRate = 512000
-	cfg.P2P.MaxPacketMsgPayloadSize = 1024
-	cfg.P2P.FlushThrottleTimeout = 120 * time.Second
-	cfg.P2P.AllowDuplicateIP = true
-	cfg.P2P.DialTimeout = 30 * time.Second
-	cfg.P2P.HandshakeTimeout = 20 * time.Second
-	cfg.P2P.MaxNumInboundPeers = 4096
-
-	userHomeDir, _ := homedir.Dir()
-	addrBookFilePath := filepath.Join(userHomeDir, ".multiseed", "addrbook-"+cfg.ChainId+".json")
-	addrBook := pex.NewAddrBook(addrBookFilePath, cfg.P2P.AddrBookStrict)
+	// set conn settings, on a copy as the config of the chain is read by the other goroutines
+	p2pConfig := *cfg.P2P
+	p2pConfig.RecvRate = 512000
+	p2pConfig.SendRate = 512000
+	p2pConfig.MaxPacketMsgPayloadSize = 1024
+	p2pConfig.FlushThrottleTimeout = 120 * time.Second
+	p2pConfig.AllowDuplicateIP = true
+	p2pConfig.DialTimeout = 30 * time.Second
+	p2pConfig.HandshakeTimeout = 20 * time.Second
+	p2pConfig.MaxNumInboundPeers = 4096
+
+	chainLogger := p2pLogger(cfg.ChainId)
+	addrBookFilePath := config.AddrBookPath(cfg.ChainId)
+	metricsLabels := []string{cfg.ChainId, cfg.PrettyName}
+	addrBook := &meteredAddrBook{AddrBook: pex.NewAddrBook(addrBookFilePath, p2pConfig.AddrBookStrict), labels: metricsLabels}
 
 	pexReactor := pex.NewReactor(addrBook, &pex.ReactorConfig{
 		SeedMode:                     true,
@@ -74,13 +91,11 @@ func startSeedNode(cfg *config.P2PConfig, nodeKey *types.NodeKey) (*p2p.Switch,
 		SeedDisconnectWaitPeriod:     15 * time.Minute, // default is 28 hours, we just want to harvest as many addresses as possible
 		PersistentPeersMaxDialPeriod: 15 * time.Minute, // use exponential back-off
 	})
-	// TODO: CAN ask for addresses
-	// pexReactor.ReceiveAddrs()
 
 	transport := p2p.NewMConnTransport(
-		noOpLogger, p2p.MConnConfig(cfg.P2P), []*p2p.ChannelDescriptor{},
+		chainLogger, p2p.MConnConfig(&p2pConfig), []*p2p.ChannelDescriptor{},
 		p2p.MConnTransportOptions{
-			MaxAcceptedConnections: uint32(cfg.P2P.MaxNumInboundPeers),
+			MaxAcceptedConnections: uint32(p2pConfig.MaxNumInboundPeers),
 		},
 	)
 
@@ -88,43 +103,54 @@ func startSeedNode(cfg *config.P2PConfig, nodeKey *types.NodeKey) (*p2p.Switch,
 		nodeKey.ID.AddressString(nodeInfo.ListenAddr),
 	)
 	if err != nil {
-		logger.Error("Panic for chain " + cfg.PrettyName)
-		panic(err)
+		return nil, err
 	}
 	if err := transport.Listen(p2p.NewEndpoint(addr)); err != nil {
-		logger.Error("Panic for chain " + cfg.PrettyName)
-		panic(err)
+		return nil, err
 	}
-	sw := p2p.NewSwitch(cfg.P2P, transport)
+	sw := p2p.NewSwitch(&p2pConfig, transport)
 
-	sw.SetLogger(noOpLogger)
-	sw.BaseService.SetLogger(noOpLogger)
-	addrBook.SetLogger(noOpLogger)
-	pexReactor.SetLogger(noOpLogger)
+	sw.SetLogger(chainLogger)
+	sw.BaseService.SetLogger(chainLogger)
+	addrBook.SetLogger(chainLogger.With("component", "addrbook"))
+	pexReactor.SetLogger(chainLogger.With("component", "pex"))
 
 	sw.SetNodeKey(*nodeKey)
 	sw.SetAddrBook(addrBook)
-	sw.AddReactor("pex", pexReactor)
+	health := newHealth()
+	crawler := newCrawler(explorers.crawler, sw, addrBook, pexReactor, metricsLabels)
+	addrBook.crawler = crawler
+	nodeInfos := newNodeInfos(cfg.ChainId)
+	sw.AddReactor("pex", &meteredPexReactor{pexReactor, metricsLabels, health, crawler, nodeInfos})
 
 	// last
 	sw.SetNodeInfo(nodeInfo)
 
 	err = sw.Start()
 	if err != nil {
-		logger.Error("Panic for chain " + cfg.PrettyName)
-		panic(err)
+		_ = transport.Close()
+		return nil, err
 	}
 
 	dialAddressBookPeers(addrBook, sw)
-	tmos.TrapSignal(logger, func() {
-		logger.Info("Shutting down chain " + cfg.PrettyName)
-		addrBook.Save()
-		_ = addrBook.Stop()
-		_ = sw.Stop()
-		_ = pexReactor.Stop()
-	})
+	crawler.Start()
+	prober := newProber(explorers.prober, cfg.ChainId, sw, transport, addrBook, nodeKey.PrivKey, nodeInfos, metricsLabels)
+	prober.Start()
+
+	return &SeedNodeConfig{sw, cfg, addrBook, pexReactor, transport, health, crawler, prober, nodeInfos, metricsLabels}, nil
+}
 
-	return sw, addrBook
+// stopSeedNode saves the address book, stops the switch and releases the listen address
+func stopSeedNode(seedNode *SeedNodeConfig) {
+	logger.Info("Shutting down chain " + seedNode.Cfg.PrettyName)
+	seedNode.Crawler.Stop()
+	seedNode.Prober.Stop()
+	seedNode.NodeInfos.Save()
+	seedNode.AddrBook.Save()
+	_ = seedNode.AddrBook.Stop()
+	_ = seedNode.Sw.Stop()
+	_ = seedNode.PexReactor.Stop()
+	_ = seedNode.Transport.Close()
 }
 
 func dialAddressBookPeers(addrBook pex.AddrBook, sw *p2p.Switch) {
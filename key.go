@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/HighStakesSwitzerland/tendermint/types"
+	"github.com/highstakesswitzerland/multiseed/internal/config"
+	"os"
+)
+
+const keyUsage = `Usage: multiseed key rotate [--chain <chain_id>]
+
+Generates a new node key and archives the old one. Without --chain, the shared node key is rotated,
+else the dedicated key of the chain (its node_key_file). The address books are kept.
+`
+
+// runKeyCommand handles the "multiseed key" subcommands
+func runKeyCommand(args []string) error {
+	if len(args) == 0 || args[0] != "rotate" {
+		fmt.Print(keyUsage)
+		return errors.New("unknown key command")
+	}
+
+	flags := newFlagSet("key rotate", "Generate a new node key and archive the old one")
+	chainId := flags.String("chain", "", "chain whose dedicated node key is rotated, the shared one when unset")
+	if err := parseFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	return rotateKey(*chainId)
+}
+
+func rotateKey(chainId string) error {
+	seedConfigs, err := config.LoadConfigs()
+	if err != nil {
+		return err
+	}
+	// only printed, a missing shared key is reported by printSeedAddresses
+	var sharedKey *types.NodeKey
+	if nodeKey, err := config.ReadSharedNodeKey(); err == nil {
+		sharedKey = &nodeKey
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	path := config.SharedNodeKeyPath()
+	if chainId != "" {
+		cfg := findChain(seedConfigs, chainId)
+		if cfg == nil {
+			return fmt.Errorf("chain %s is not configured", chainId)
+		}
+		if cfg.UsesSharedNodeKey() {
+			return fmt.Errorf("chain %s uses the shared node key, set its node_key_file to give it a dedicated one", chainId)
+		}
+		path = cfg.NodeKeyPath()
+	}
+
+	nodeKey, archivePath, err := config.RotateNodeKey(path)
+	if err != nil {
+		return err
+	}
+	if archivePath != "" {
+		fmt.Printf("Archived the old node key to %s\n", archivePath)
+	}
+	fmt.Printf("New node key %s saved to %s\n\n", nodeKey.ID, path)
+	if chainId == "" {
+		sharedKey = &nodeKey
+	}
+
+	if err := printSeedAddresses(seedConfigs, sharedKey); err != nil {
+		return err
+	}
+	if chainId != "" {
+		fmt.Println("\nRestart multiseed or the chain (admin API) to use the new key, the address books are kept.")
+	} else {
+		fmt.Println("\nRestart multiseed to use the new key, the address books are kept.")
+	}
+	return nil
+}
@@ -1,43 +1,183 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/HighStakesSwitzerland/tendermint/libs/log"
 	"github.com/highstakesswitzerland/multiseed/internal/config"
 	"github.com/highstakesswitzerland/multiseed/internal/geoloc"
+	"github.com/highstakesswitzerland/multiseed/internal/history"
 	"github.com/highstakesswitzerland/multiseed/internal/http"
+	"github.com/highstakesswitzerland/multiseed/internal/lifecycle"
+	"github.com/highstakesswitzerland/multiseed/internal/logging"
 	"github.com/highstakesswitzerland/multiseed/internal/seednode"
+	"os"
+	"sync"
 	"time"
 )
 
+const httpDrainTimeout = 10 * time.Second
+
 var (
 	logger = log.MustNewDefaultLogger("text", "info", false)
-	ticker = time.NewTicker(300 * time.Second) // should staymin 60 sec to match the ip-api service rate limit
 )
 
 func main() {
-	seedConfigs, nodeKey := config.InitConfigs()
-	var seedSwitchs []seednode.SeedNodeConfig
+	exitOnError(runCommand(os.Args[1:]))
+}
+
+// runStart runs the seed nodes of every chain, the web server and the geolocation until the process is stopped
+func runStart(args []string) error {
+	flags := newFlagSet("start", "Run the seed nodes")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	seedConfigs, err := config.LoadConfigs()
+	if err != nil {
+		return err
+	}
+	nodeKey, err := config.LoadOrGenSharedNodeKey()
+	if err != nil {
+		return err
+	}
+	if err := setupLoggers(seedConfigs); err != nil {
+		return err
+	}
+	logger.Info("Loaded config file: " + config.ConfigFilePath())
+	logger.Info("Shared node key: ", "nodeId", nodeKey.ID)
+
+	lc := lifecycle.New(logger, lifecycle.DefaultShutdownTimeout)
+
+	if err := geoloc.InitProvider(seedConfigs.Geoloc); err != nil {
+		return err
+	}
+	geoloc.LoadCache(seedConfigs.Geoloc.CacheTTL)
+	if err := history.Init(seedConfigs.History); err != nil {
+		return err
+	}
 
 	logger.Info("Starting Web Server on port " + seedConfigs.HttpPort)
-	http.StartWebServer(seedConfigs)
+	server := http.StartWebServer(seedConfigs, lc.Fatal)
+
+	// the resolved peers of a chain are shown while it runs
+	seedNodes := seednode.StartSeedNodes(seedConfigs, &nodeKey, seednode.Hooks{
+		Started: geoloc.LoadSavedResolvedPeers,
+		Stopped: func(seedNode seednode.SeedNodeConfig) {
+			geoloc.ResolvedPeers.RemoveChain(seedNode.Cfg.ChainId)
+			seedNode.DeleteMetrics()
+		},
+	})
+	http.RegisterMetrics(seedNodes.List)
+	http.RegisterHealthApi(seedConfigs.Health, seedNodes)
+	http.RegisterChainsApi(seedNodes)
+
+	scheduler := geoloc.NewScheduler(seedNodes.List, seedConfigs.Geoloc.Interval)
+	http.RegisterAdminApi(seedConfigs.Admin, seedNodes, scheduler)
 
-	seedSwitchs = seednode.StartSeedNodes(seedConfigs, &nodeKey)
+	config.WatchConfig(func(tsConfig *config.TSConfig) {
+		if lc.Context().Err() == nil { // don't start chains while shutting down
+			applyConfigChanges(seedNodes, tsConfig)
+		}
+	})
+	tasksDone := startBackgroundTasks(lc.Context(), seedNodes, scheduler)
+
+	// the components are stopped in this order. The address books are saved first, so they are not lost if a
+	// component doesn't stop in time
+	lc.OnStop("address books", func(ctx context.Context) error {
+		seedNodes.SaveAll()
+		return nil
+	})
+	lc.OnStop("background tasks", func(ctx context.Context) error {
+		select {
+		case <-tasksDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	lc.OnStop("web server", func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, httpDrainTimeout)
+		defer cancel()
+		return server.Shutdown(ctx)
+	})
+	lc.OnStop("seed nodes", func(ctx context.Context) error {
+		seedNodes.StopAll()
+		return nil
+	})
+	lc.OnStop("history database", func(ctx context.Context) error {
+		history.Close()
+		return nil
+	})
+
+	if code := lc.Wait(); code != lifecycle.ExitOk {
+		return exitCodeError(code)
+	}
+	return nil
+}
 
-	for _, cfg := range seedSwitchs {
-		geoloc.LoadSavedResolvedPeers(cfg)
+// setupLoggers gives every package its logger, with the level and format of the config
+func setupLoggers(seedConfigs *config.TSConfig) error {
+	loggers, err := logging.New(seedConfigs.LogFormat, seedConfigs.LogLevel)
+	if err != nil {
+		return err
 	}
-	StartGeolocServiceAndBlock(seedSwitchs)
+	logger = loggers.Module("main")
+	config.SetLogger(loggers.Module("config"))
+	seednode.SetLogger(loggers.Module("seednode"), loggers.Chain)
+	geoloc.SetLogger(loggers.Module("geoloc"))
+	history.SetLogger(loggers.Module("history"))
+	http.SetLogger(loggers.Module("http"))
+	return nil
 }
 
-func StartGeolocServiceAndBlock(seedNodes []seednode.SeedNodeConfig) {
+// applyConfigChanges starts and stops the chains added or removed from the config file, without restarting the others
+func applyConfigChanges(seedNodes *seednode.Manager, tsConfig *config.TSConfig) {
+	http.SetAdminToken(tsConfig.Admin.Token)
+	http.SetNoPeersTimeout(tsConfig.Health.NoPeersTimeout)
+	changes := seedNodes.Apply(tsConfig)
+	logger.Info(fmt.Sprintf("Applied config changes: %d chains started, %d stopped, %d updated",
+		len(changes.Started), len(changes.Stopped), len(changes.Updated)))
+}
+
+// startBackgroundTasks runs the geolocation and the periodic tasks until ctx is cancelled. The returned channel is
+// closed once they are all stopped
+func startBackgroundTasks(ctx context.Context, seedNodes *seednode.Manager, scheduler *geoloc.Scheduler) <-chan struct{} {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		scheduler.Run(ctx)
+	}()
+
 	// Fire periodically
-	for {
-		select {
-		case <-ticker.C:
-			for _, seedNodeConfig := range seedNodes {
-				seednode.SaveLastSeenAttrInAddrbook(seedNodeConfig) // update LastSeen values in address book at it is not done automatically on seed mode reactor
-				geoloc.ResolveIps(seedNodeConfig)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(300 * time.Second)
+		defer ticker.Stop()
+		historyTicker := time.NewTicker(history.Interval())
+		defer historyTicker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, seedNodeConfig := range seedNodes.List() {
+					seednode.SaveLastSeenAttrInAddrbook(seedNodeConfig) // update LastSeen values in address book at it is not done automatically on seed mode reactor
+					geoloc.RefreshLiveness(seedNodeConfig)
+				}
+			case <-historyTicker.C:
+				for _, seedNodeConfig := range seedNodes.List() {
+					history.Record(seedNodeConfig)
+				}
+				history.Prune()
+			case <-ctx.Done():
+				return
 			}
 		}
-	}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
 }